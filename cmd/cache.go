@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/cespare/xxhash/v2"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// QueryCache
+// File based cache of query responses, so reruns don't load the backend again
+type QueryCache struct {
+	dir    string
+	ttl    time.Duration
+	bucket time.Duration
+	logger *log.Entry
+}
+
+// CreateCache
+// Creates cache directory and removes expired entries from it
+func CreateCache(dir string, ttl time.Duration, bucket time.Duration, logger *log.Entry) (*QueryCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if bucket <= 0 {
+		bucket = time.Hour
+	}
+	cache := QueryCache{
+		dir:    dir,
+		ttl:    ttl,
+		bucket: bucket,
+		logger: logger,
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") || !cache.expired(file) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, file.Name())); err != nil {
+			logger.Warnf("Cannot remove expired cache entry %s: %v", file.Name(), err)
+		}
+	}
+	return &cache, nil
+}
+
+// key
+// Same query to the same backend evaluated within one time bucket gives the same key
+func (cache *QueryCache) key(backend string, query string, evalTime time.Time) string {
+	bucket := evalTime.Truncate(cache.bucket).Unix()
+	return fmt.Sprintf("%016x.json", xxhash.Sum64String(fmt.Sprintf("%s\n%s\n%d", backend, query, bucket)))
+}
+
+func (cache *QueryCache) expired(file os.FileInfo) bool {
+	return cache.ttl > 0 && time.Since(file.ModTime()) > cache.ttl
+}
+
+// Get
+// Returns cached response body, if it exists and not expired
+func (cache *QueryCache) Get(backend string, query string, evalTime time.Time) ([]byte, bool) {
+	path := filepath.Join(cache.dir, cache.key(backend, query, evalTime))
+	file, err := os.Stat(path)
+	if err != nil || cache.expired(file) {
+		return nil, false
+	}
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		cache.logger.Debugf("Cannot read cache entry %s: %v", path, err)
+		return nil, false
+	}
+	return body, true
+}
+
+// Put
+// Saves response body, temporary file is used so concurrent readers never see partial data
+func (cache *QueryCache) Put(backend string, query string, evalTime time.Time, body []byte) error {
+	path := filepath.Join(cache.dir, cache.key(backend, query, evalTime))
+	temp, err := ioutil.TempFile(cache.dir, "entry-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(body); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sigs.k8s.io/yaml"
+	"sort"
+)
+
+// Hours in an average month
+const hoursPerMonth = 730
+
+// Team of pods without team label
+const unassignedTeam = "unassigned"
+
+// Price
+// Price of resources per hour
+type Price struct {
+	CPUCoreHour   float64 `json:"cpuCoreHour"`
+	MemoryGiBHour float64 `json:"memoryGiBHour"`
+}
+
+// DatacenterPricing
+// Prices of a datacenter, node pools override them
+type DatacenterPricing struct {
+	Price
+	NodePools map[string]Price `json:"nodePools"`
+}
+
+// Pricing
+// Prices loaded from YAML file, datacenters without prices use the default one
+type Pricing struct {
+	Currency      string                       `json:"currency"`
+	NodePoolLabel string                       `json:"nodePoolLabel"` // Node label with node pool name
+	Default       Price                        `json:"default"`
+	Datacenters   map[string]DatacenterPricing `json:"datacenters"`
+}
+
+// PodCost
+// Monthly cost of a pod
+type PodCost struct {
+	Requests float64 `json:"requests"` // Cost of requested resources
+	Usage    float64 `json:"usage"`    // Cost of used resources
+	Idle     float64 `json:"idle"`     // Cost of requested, but not used resources
+}
+
+// CostSummary
+// Monthly cost of a group of pods
+type CostSummary struct {
+	Name string
+	Pods int
+	PodCost
+}
+
+type CostSummaryByIdleDesc []CostSummary
+
+// LoadPricing
+// Reads and validates pricing file
+func LoadPricing(path string) (*Pricing, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pricing := Pricing{}
+	if err := yaml.UnmarshalStrict(data, &pricing); err != nil {
+		return nil, err
+	}
+	if pricing.Currency == "" {
+		pricing.Currency = "$"
+	}
+	if err := pricing.Default.validate(); err != nil {
+		return nil, fmt.Errorf("default: %w", err)
+	}
+	for name, dc := range pricing.Datacenters {
+		if err := dc.Price.validate(); err != nil {
+			return nil, fmt.Errorf("datacenter %s: %w", name, err)
+		}
+		for pool, price := range dc.NodePools {
+			if err := price.validate(); err != nil {
+				return nil, fmt.Errorf("datacenter %s, node pool %s: %w", name, pool, err)
+			}
+		}
+		if len(dc.NodePools) > 0 && pricing.NodePoolLabel == "" {
+			return nil, fmt.Errorf("datacenter %s has node pools, but nodePoolLabel is not provided", name)
+		}
+	}
+	return &pricing, nil
+}
+
+func (price Price) validate() error {
+	if price.CPUCoreHour < 0 || price.MemoryGiBHour < 0 {
+		return errors.New("prices must not be negative")
+	}
+	return nil
+}
+
+// price returns price for pod, node pool price is used if it is known
+func (pricing *Pricing) price(dc string, pod *PodInfo) Price {
+	dcPricing, ok := pricing.Datacenters[dc]
+	if !ok {
+		return pricing.Default
+	}
+	if pool, ok := pod.NodeLabels[pricing.NodePoolLabel]; ok && pricing.NodePoolLabel != "" {
+		if price, ok := dcPricing.NodePools[pool]; ok {
+			return price
+		}
+	}
+	return dcPricing.Price
+}
+
+// PodCost
+// Calculates monthly cost of pod requests and usage. Usage is the average over the window, as peaks are
+// reached only for a short time. Usage above requests is not idle
+func (pricing *Pricing) PodCost(dc string, pod *PodInfo) PodCost {
+	price := pricing.price(dc, pod)
+	monthly := func(cpu float64, ram float64) float64 {
+		return (cpu/1000*price.CPUCoreHour + ram/1024*price.MemoryGiBHour) * hoursPerMonth
+	}
+	return PodCost{
+		Requests: monthly(pod.CPURequsts, pod.RAMRequests),
+		Usage:    monthly(pod.CPUAverage, pod.RAMAverage),
+		Idle:     monthly(math.Max(0, pod.CPURequsts-pod.CPUAverage), math.Max(0, pod.RAMRequests-pod.RAMAverage)),
+	}
+}
+
+// Format formats amount with currency like "$1234.56"
+func (pricing *Pricing) Format(amount float64) string {
+	return fmt.Sprintf("%s%.2f", pricing.Currency, amount)
+}
+
+// costsBy sums cost of pods grouped by key, the biggest idle cost is the first
+func costsBy(pods []PodInfo, key func(pod PodInfo) string) []CostSummary {
+	var summaries []CostSummary
+	index := map[string]int{}
+	for _, pod := range pods {
+		name := key(pod)
+		i, ok := index[name]
+		if !ok {
+			summaries = append(summaries, CostSummary{Name: name})
+			i = len(summaries) - 1
+			index[name] = i
+		}
+		summaries[i].Pods++
+		summaries[i].Requests += pod.Cost.Requests
+		summaries[i].Usage += pod.Cost.Usage
+		summaries[i].Idle += pod.Cost.Idle
+	}
+	sort.Sort(CostSummaryByIdleDesc(summaries))
+	return summaries
+}
+
+// totalCost sums cost of all pods
+func totalCost(pods []PodInfo) CostSummary {
+	total := CostSummary{Name: "total"}
+	for _, pod := range pods {
+		total.Pods++
+		total.Requests += pod.Cost.Requests
+		total.Usage += pod.Cost.Usage
+		total.Idle += pod.Cost.Idle
+	}
+	return total
+}
+
+// Sorting cost summaries, the biggest idle cost is the first
+func (summaries CostSummaryByIdleDesc) Len() int { return len(summaries) }
+
+func (summaries CostSummaryByIdleDesc) Less(i, j int) bool {
+	return summaries[i].Idle > summaries[j].Idle
+}
+
+func (summaries CostSummaryByIdleDesc) Swap(i, j int) {
+	summaries[i], summaries[j] = summaries[j], summaries[i]
+}
+
+// podTeam returns team from pod label, then from namespace label
+func podTeam(pod *PodInfo, label string) string {
+	if team := pod.Labels[label]; team != "" {
+		return team
+	}
+	if team := pod.NamespaceLabels[label]; team != "" {
+		return team
+	}
+	return unassignedTeam
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"github.com/hashicorp/go-multierror"
+	"sync"
+)
+
+// errorCollector
+// Collects errors from several goroutines
+type errorCollector struct {
+	mutex  sync.Mutex
+	errors *multierror.Error
+}
+
+func (collector *errorCollector) Add(err error) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.errors = multierror.Append(collector.errors, err)
+}
+
+func (collector *errorCollector) ErrorOrNil() error {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	return collector.errors.ErrorOrNil()
+}
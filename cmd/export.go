@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExportSchemaVersion
+// Version of JSON and CSV export schema, it is increased on incompatible changes only
+const ExportSchemaVersion = 1
+
+// ExportDocument
+// Full dataset of the report
+type ExportDocument struct {
+	SchemaVersion int         `json:"schemaVersion"`
+	GeneratedAt   time.Time   `json:"generatedAt"`
+	EvalTime      time.Time   `json:"evalTime"`
+	Partial       bool        `json:"partial"`
+	PointInTime   bool        `json:"pointInTime"` // Usage is current, not the peak over 7 days
+	Units         ExportUnits `json:"units"`
+	Pods          []ExportPod `json:"pods"`
+	Summaries     []ExportDC  `json:"datacenters"`
+}
+
+type ExportUnits struct {
+	CPU    string `json:"cpu"`
+	Memory string `json:"memory"`
+	Rate   string `json:"rate"`
+	Cost   string `json:"cost"`
+}
+
+// ExportDC
+// Summary of a datacenter
+type ExportDC struct {
+	Name    string  `json:"name"`
+	Summary Summary `json:"summary"`
+}
+
+// ExportPod
+// Pod with its containers and recommendations
+type ExportPod struct {
+	Datacenter     string            `json:"datacenter"`
+	Namespace      string            `json:"namespace"`
+	Name           string            `json:"name"`
+	WorkloadKind   string            `json:"workloadKind"`
+	Workload       string            `json:"workload"`
+	Team           string            `json:"team"`
+	QOSClass       string            `json:"qosClass"`
+	CreatedAt      time.Time         `json:"createdAt"`
+	Processed      bool              `json:"processed"`
+	CPU            ExportResource    `json:"cpu"`
+	Memory         ExportResource    `json:"memory"`
+	WorkingSet     float64           `json:"workingSet"`
+	Throttling     float64           `json:"throttling"`
+	NetworkRx      float64           `json:"networkRx"`
+	NetworkTx      float64           `json:"networkTx"`
+	DiskRead       float64           `json:"diskRead"`
+	DiskWrite      float64           `json:"diskWrite"`
+	MonthlyCost    PodCost           `json:"monthlyCost"`
+	PolicyFindings []PolicyFinding   `json:"policyFindings"`
+	Suppressed     []string          `json:"suppressed"`
+	Containers     []ExportContainer `json:"containers"`
+}
+
+// ExportResource
+// Usage, requests and limits with score of a resource
+type ExportResource struct {
+	Usage               float64            `json:"usage"`
+	Requests            float64            `json:"requests"`
+	Limits              float64            `json:"limits"`
+	Efficiency          float64            `json:"efficiency"`
+	Findings            []string           `json:"findings"`
+	Quantiles           map[string]float64 `json:"quantiles,omitempty"`
+	RecommendedRequests float64            `json:"recommendedRequests"` // 0 if there is no recommendation
+	RecommendedLimits   float64            `json:"recommendedLimits"`
+}
+
+// ExportContainer
+// Container resources, recommendations are calculated for the whole workload
+type ExportContainer struct {
+	Name     string         `json:"name"`
+	CPU      ExportResource `json:"cpu"`
+	Memory   ExportResource `json:"memory"`
+	Restarts int32          `json:"restarts"`
+}
+
+// ExportReport
+// Converts report to export document
+func ExportReport(report *Report) *ExportDocument {
+	document := ExportDocument{
+		SchemaVersion: ExportSchemaVersion,
+		GeneratedAt:   report.GeneratedAt,
+		EvalTime:      report.EvalTime,
+		Partial:       report.Partial(),
+		PointInTime:   report.PointInTime,
+		Units: ExportUnits{
+			CPU:    "millicores",
+			Memory: "MiB",
+			Rate:   "bytes/s",
+			Cost:   strings.TrimSpace(report.Currency + " per month"),
+		},
+		Pods:      []ExportPod{},
+		Summaries: []ExportDC{},
+	}
+	for _, dc := range report.Datacenters {
+		document.Summaries = append(document.Summaries, ExportDC{Name: dc.Name, Summary: dc.Summary})
+		recommendations := recommendationsByWorkload(dc.Recommendations)
+		for _, pod := range dc.Pods {
+			document.Pods = append(document.Pods, exportPod(dc.Name, pod, recommendations[workloadKey(pod.Namespace, pod.WorkloadKind, pod.Workload)]))
+		}
+	}
+	return &document
+}
+
+func exportPod(dc string, pod PodInfo, recommendations []Recommendation) ExportPod {
+	exported := ExportPod{
+		Datacenter:   dc,
+		Namespace:    pod.Namespace,
+		Name:         pod.Name,
+		WorkloadKind: pod.WorkloadKind,
+		Workload:     pod.Workload,
+		Team:         pod.Team,
+		QOSClass:     pod.QOSClass,
+		CreatedAt:    pod.CreatedAt,
+		Processed:    pod.Processed,
+		CPU: ExportResource{
+			Usage:      pod.CPUMetric,
+			Requests:   pod.CPURequsts,
+			Limits:     pod.CPULimits,
+			Efficiency: pod.CPUScore.Efficiency,
+			Findings:   pod.CPUScore.Findings.Names(),
+			Quantiles:  pod.CPUQuantiles,
+		},
+		Memory: ExportResource{
+			Usage:      pod.RAMMetric,
+			Requests:   pod.RAMRequests,
+			Limits:     pod.RAMLimits,
+			Efficiency: pod.RAMScore.Efficiency,
+			Findings:   pod.RAMScore.Findings.Names(),
+			Quantiles:  pod.RAMQuantiles,
+		},
+		WorkingSet:     pod.RAMWorkingSet,
+		Throttling:     pod.CPUThrottling,
+		NetworkRx:      pod.NetRxRate,
+		NetworkTx:      pod.NetTxRate,
+		DiskRead:       pod.FsReadRate,
+		DiskWrite:      pod.FsWriteRate,
+		MonthlyCost:    pod.Cost,
+		PolicyFindings: []PolicyFinding{},
+		Suppressed:     []string{},
+		Containers:     []ExportContainer{},
+	}
+	exported.PolicyFindings = append(exported.PolicyFindings, pod.PolicyFindings...)
+	for finding := range pod.Ignored {
+		exported.Suppressed = append(exported.Suppressed, finding)
+	}
+	sort.Strings(exported.Suppressed)
+
+	for _, container := range pod.Containers {
+		exportedContainer := ExportContainer{
+			Name:     container.Name,
+			CPU:      ExportResource{Usage: container.CPUMetric, Requests: container.CPURequsts, Limits: container.CPULimits, Findings: []string{}},
+			Memory:   ExportResource{Usage: container.RAMMetric, Requests: container.RAMRequests, Limits: container.RAMLimits, Findings: []string{}},
+			Restarts: container.Restarts,
+		}
+		for _, recommendation := range recommendations {
+			if recommendation.Container != container.Name {
+				continue
+			}
+			exportedContainer.CPU.RecommendedRequests = recommendation.CPURequests.Recommended
+			exportedContainer.CPU.RecommendedLimits = recommendation.CPULimits.Recommended
+			exportedContainer.Memory.RecommendedRequests = recommendation.RAMRequests.Recommended
+			exportedContainer.Memory.RecommendedLimits = recommendation.RAMLimits.Recommended
+		}
+		exported.CPU.RecommendedRequests += exportedContainer.CPU.RecommendedRequests
+		exported.CPU.RecommendedLimits += exportedContainer.CPU.RecommendedLimits
+		exported.Memory.RecommendedRequests += exportedContainer.Memory.RecommendedRequests
+		exported.Memory.RecommendedLimits += exportedContainer.Memory.RecommendedLimits
+		exported.Containers = append(exported.Containers, exportedContainer)
+	}
+	return exported
+}
+
+// nopCloser does not close stdout after writing
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// openOutput opens file for writing, "-" or empty path is stdout
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONSink
+// Writes the full dataset as JSON document to file or stdout
+type JSONSink struct {
+	path string
+}
+
+func CreateJSONSink(path string) *JSONSink {
+	return &JSONSink{path: path}
+}
+
+func (sink *JSONSink) Name() string {
+	return "json"
+}
+
+func (sink *JSONSink) Write(ctx context.Context, report *Report) error {
+	output, err := openOutput(sink.path)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(ExportReport(report)); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
+
+// CSVSink
+// Writes one row per pod to file or stdout, values are in the units of JSON export
+type CSVSink struct {
+	path string
+}
+
+func CreateCSVSink(path string) *CSVSink {
+	return &CSVSink{path: path}
+}
+
+func (sink *CSVSink) Name() string {
+	return "csv"
+}
+
+// csvColumns
+// Columns of CSV export, new columns are added to the end
+var csvColumns = []string{
+	"schema_version", "datacenter", "namespace", "pod", "workload_kind", "workload", "team", "qos_class", "processed",
+	"cpu_usage_m", "cpu_requests_m", "cpu_limits_m", "cpu_efficiency", "cpu_findings", "cpu_recommended_requests_m", "cpu_recommended_limits_m",
+	"memory_usage_mi", "memory_working_set_mi", "memory_requests_mi", "memory_limits_mi", "memory_efficiency", "memory_findings", "memory_recommended_requests_mi", "memory_recommended_limits_mi",
+	"cpu_throttling", "network_rx_bps", "network_tx_bps", "disk_read_bps", "disk_write_bps",
+	"monthly_cost_requests", "monthly_cost_usage", "monthly_cost_idle", "policy_findings", "suppressed",
+}
+
+func (sink *CSVSink) Write(ctx context.Context, report *Report) error {
+	output, err := openOutput(sink.path)
+	if err != nil {
+		return err
+	}
+	if err := writeCSV(csv.NewWriter(output), ExportReport(report)); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
+
+func writeCSV(writer *csv.Writer, document *ExportDocument) error {
+	if err := writer.Write(csvColumns); err != nil {
+		return err
+	}
+	for _, pod := range document.Pods {
+		var policyFindings []string
+		for _, finding := range pod.PolicyFindings {
+			policyFindings = append(policyFindings, finding.Rule)
+		}
+		row := []string{
+			strconv.Itoa(document.SchemaVersion), pod.Datacenter, pod.Namespace, pod.Name, pod.WorkloadKind, pod.Workload, pod.Team, pod.QOSClass, strconv.FormatBool(pod.Processed),
+			formatFloat(pod.CPU.Usage), formatFloat(pod.CPU.Requests), formatFloat(pod.CPU.Limits), formatFloat(pod.CPU.Efficiency), strings.Join(pod.CPU.Findings, ";"),
+			formatFloat(pod.CPU.RecommendedRequests), formatFloat(pod.CPU.RecommendedLimits),
+			formatFloat(pod.Memory.Usage), formatFloat(pod.WorkingSet), formatFloat(pod.Memory.Requests), formatFloat(pod.Memory.Limits), formatFloat(pod.Memory.Efficiency), strings.Join(pod.Memory.Findings, ";"),
+			formatFloat(pod.Memory.RecommendedRequests), formatFloat(pod.Memory.RecommendedLimits),
+			formatFloat(pod.Throttling), formatFloat(pod.NetworkRx), formatFloat(pod.NetworkTx), formatFloat(pod.DiskRead), formatFloat(pod.DiskWrite),
+			formatFloat(pod.MonthlyCost.Requests), formatFloat(pod.MonthlyCost.Usage), formatFloat(pod.MonthlyCost.Idle),
+			strings.Join(policyFindings, ";"), strings.Join(pod.Suppressed, ";"),
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("cannot write csv: %w", err)
+	}
+	return nil
+}
+
+// formatFloat formats value without exponent and trailing zeros
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,424 @@
+package cmd
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Geometry of charts, in pixels
+const (
+	chartBars       = 15
+	chartBarHeight  = 24
+	chartLabelWidth = 180
+	chartBarWidth   = 360
+	chartTextWidth  = 160
+	chartTop        = 28
+)
+
+//go:embed templates/report.html templates/report.css templates/report.js templates/email.html
+var htmlFiles embed.FS
+
+var htmlTemplate = template.Must(template.New("report.html").Funcs(template.FuncMap{
+	"add": func(a, b int) int { return a + b },
+	"sub": func(a, b int) int { return a - b },
+}).ParseFS(htmlFiles, "templates/report.html"))
+
+// HTMLSink
+// Writes the report with all rows as a single self-contained HTML page to file or stdout
+type HTMLSink struct {
+	path string
+}
+
+func CreateHTMLSink(path string) *HTMLSink {
+	return &HTMLSink{path: path}
+}
+
+func (sink *HTMLSink) Name() string {
+	return "html"
+}
+
+func (sink *HTMLSink) Write(ctx context.Context, report *Report) error {
+	output, err := openOutput(sink.path)
+	if err != nil {
+		return err
+	}
+	if err := RenderHTML(output, report); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
+
+// htmlPage
+// Data of HTML template
+type htmlPage struct {
+	Title       string
+	GeneratedAt time.Time
+	EvalTime    time.Time
+	UsageNote   string
+	Partial     bool
+	Processed   int
+	Total       int
+	CSS         template.CSS
+	JS          template.JS
+	Datacenters []htmlDatacenter
+	Appendix    []htmlTable
+}
+
+type htmlDatacenter struct {
+	ID     string
+	Name   string
+	Cards  []htmlCard
+	Charts []htmlChart
+	Tables []htmlTable
+}
+
+type htmlCard struct {
+	Label string
+	Value string
+}
+
+// htmlChart
+// Horizontal bar chart of requests and usage, bars are scaled to the biggest value
+type htmlChart struct {
+	Title   string
+	Width   int
+	Height  int
+	BarX    int
+	LegendX int
+	Bars    []htmlBar
+}
+
+type htmlBar struct {
+	Label        string
+	Y            int
+	Requests     int // Width of requests bar
+	Usage        int // Width of usage bar
+	Width        int // Width of the longest bar
+	RequestsText string
+	UsageText    string
+}
+
+type htmlTable struct {
+	ID      string
+	Title   string
+	Columns []string
+	Rows    [][]htmlCell
+}
+
+// htmlCell
+// Cell text and raw value used for sorting, empty value means text is sorted
+type htmlCell struct {
+	Text  string
+	Value string
+}
+
+var htmlIDReplacer = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// htmlID returns value which is safe for id attribute
+func htmlID(value string) string {
+	return htmlIDReplacer.ReplaceAllString(value, "-")
+}
+
+// RenderHTML
+// Renders report as HTML page with embedded styles and scripts
+func RenderHTML(writer io.Writer, report *Report) error {
+	css, err := htmlFiles.ReadFile("templates/report.css")
+	if err != nil {
+		return err
+	}
+	js, err := htmlFiles.ReadFile("templates/report.js")
+	if err != nil {
+		return err
+	}
+	page := htmlPage{
+		Title:       report.Title,
+		GeneratedAt: report.GeneratedAt,
+		EvalTime:    report.EvalTime,
+		UsageNote:   report.UsageNote(),
+		Partial:     report.Partial(),
+		Processed:   report.Processed,
+		Total:       report.Total,
+		CSS:         template.CSS(css),
+		JS:          template.JS(js),
+	}
+	document := ExportReport(report)
+	for _, dc := range report.Datacenters {
+		page.Datacenters = append(page.Datacenters, htmlDatacenterPage(dc, datacenterPods(document.Pods, dc.Name), report.Currency))
+	}
+	for _, section := range report.Appendix {
+		page.Appendix = append(page.Appendix, sectionTable(section))
+	}
+	if err := htmlTemplate.Execute(writer, page); err != nil {
+		return fmt.Errorf("cannot render html: %w", err)
+	}
+	return nil
+}
+
+// datacenterPods returns exported pods of datacenter
+func datacenterPods(pods []ExportPod, dc string) []ExportPod {
+	var filtered []ExportPod
+	for _, pod := range pods {
+		if pod.Datacenter == dc {
+			filtered = append(filtered, pod)
+		}
+	}
+	return filtered
+}
+
+// htmlDatacenterPage returns cards, charts and tables of datacenter
+func htmlDatacenterPage(dc DatacenterReport, pods []ExportPod, currency string) htmlDatacenter {
+	page := htmlDatacenter{
+		ID:    htmlID("dc-" + dc.Name),
+		Name:  strings.ToUpper(dc.Name),
+		Cards: htmlCards(dc.Summary, pods, currency),
+	}
+
+	// Requests and usage by namespace
+	namespaces := map[string]*Summary{}
+	var names []string
+	for _, pod := range pods {
+		if !pod.Processed {
+			continue
+		}
+		namespace, ok := namespaces[pod.Namespace]
+		if !ok {
+			namespace = &Summary{}
+			namespaces[pod.Namespace] = namespace
+			names = append(names, pod.Namespace)
+		}
+		namespace.CPURequests += pod.CPU.Requests
+		namespace.CPUUsage += pod.CPU.Usage
+		namespace.RAMRequests += pod.Memory.Requests
+		namespace.RAMUsage += pod.Memory.Usage
+	}
+	page.Charts = []htmlChart{
+		barChart("CPU by namespace", names, "m", func(name string) (float64, float64) {
+			return namespaces[name].CPURequests, namespaces[name].CPUUsage
+		}),
+		barChart("RAM by namespace", names, "Mi", func(name string) (float64, float64) {
+			return namespaces[name].RAMRequests, namespaces[name].RAMUsage
+		}),
+	}
+
+	page.Tables = append(page.Tables, podsTable(page.ID+"-pods", pods, currency), workloadsTable(page.ID+"-workloads", pods))
+	for _, section := range dc.Sections {
+		page.Tables = append(page.Tables, sectionTable(section))
+	}
+	return page
+}
+
+// htmlCards returns summary cards of datacenter
+func htmlCards(summary Summary, pods []ExportPod, currency string) []htmlCard {
+	cards := []htmlCard{
+		{Label: "Pods with metrics", Value: fmt.Sprintf("%d / %d", summary.ProcessedPods, summary.Pods)},
+		{Label: "CPU used of requests", Value: fmt.Sprintf("%.1f%%", summary.CPURequestsUtilisation()*100)},
+		{Label: "RAM used of requests", Value: fmt.Sprintf("%.1f%%", summary.RAMRequestsUtilisation()*100)},
+		{Label: "Pods without requests", Value: fmt.Sprint(summary.WithoutRequests)},
+		{Label: "Pods without limits", Value: fmt.Sprint(summary.WithoutLimits)},
+	}
+	if summary.AllocatableCPU > 0 || summary.AllocatableRAM > 0 {
+		cards = append(cards,
+			htmlCard{Label: "CPU limits to allocatable", Value: fmt.Sprintf("%.0f%%", summary.CPUOvercommit()*100)},
+			htmlCard{Label: "RAM limits to allocatable", Value: fmt.Sprintf("%.0f%%", summary.RAMOvercommit()*100)})
+	}
+	if currency != "" {
+		var total PodCost
+		for _, pod := range pods {
+			total.Requests += pod.MonthlyCost.Requests
+			total.Idle += pod.MonthlyCost.Idle
+		}
+		cards = append(cards,
+			htmlCard{Label: "Monthly cost of requests", Value: fmt.Sprintf("%s%.2f", currency, total.Requests)},
+			htmlCard{Label: "Monthly idle cost", Value: fmt.Sprintf("%s%.2f", currency, total.Idle)})
+	}
+	return cards
+}
+
+// barChart returns chart of the keys with the biggest requests or usage
+func barChart(title string, keys []string, unit string, values func(key string) (float64, float64)) htmlChart {
+	sorted := append([]string{}, keys...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		requestsI, usageI := values(sorted[i])
+		requestsJ, usageJ := values(sorted[j])
+		return math.Max(requestsI, usageI) > math.Max(requestsJ, usageJ)
+	})
+	if len(sorted) > chartBars {
+		sorted = sorted[:chartBars]
+	}
+	maximum := 0.0
+	for _, key := range sorted {
+		requests, usage := values(key)
+		maximum = math.Max(maximum, math.Max(requests, usage))
+	}
+	chart := htmlChart{
+		Title:   title,
+		Width:   chartLabelWidth + chartBarWidth + chartTextWidth,
+		Height:  chartTop + len(sorted)*chartBarHeight,
+		BarX:    chartLabelWidth,
+		LegendX: chartLabelWidth,
+	}
+	for i, key := range sorted {
+		requests, usage := values(key)
+		bar := htmlBar{
+			Label:        key,
+			Y:            chartTop + i*chartBarHeight,
+			RequestsText: fmt.Sprintf("%.0f%s", requests, unit),
+			UsageText:    fmt.Sprintf("%.0f%s", usage, unit),
+		}
+		if maximum > 0 {
+			bar.Requests = int(math.Round(requests / maximum * chartBarWidth))
+			bar.Usage = int(math.Round(usage / maximum * chartBarWidth))
+		}
+		if bar.Width = bar.Requests; bar.Usage > bar.Width {
+			bar.Width = bar.Usage
+		}
+		chart.Bars = append(chart.Bars, bar)
+	}
+	return chart
+}
+
+// sectionTable converts report section to table, formatted values are sorted by their text
+func sectionTable(section Section) htmlTable {
+	table := htmlTable{ID: htmlID(section.ID), Title: section.Title, Columns: section.Columns}
+	for _, row := range section.Rows {
+		var cells []htmlCell
+		for _, value := range row {
+			cells = append(cells, htmlCell{Text: value})
+		}
+		table.Rows = append(table.Rows, cells)
+	}
+	return table
+}
+
+// numberCell returns cell of value with unit, it is sorted by value
+func numberCell(value float64, format string) htmlCell {
+	return htmlCell{Text: fmt.Sprintf(format, value), Value: formatFloat(value)}
+}
+
+// podsTable returns all pods of datacenter, including pods without metrics
+func podsTable(id string, pods []ExportPod, currency string) htmlTable {
+	table := htmlTable{
+		ID:    id,
+		Title: "All pods",
+		Columns: []string{"Ns", "Pod", "Workload", "Team", "QoS", "CPU", "CPU req", "CPU lim", "CPU efficiency",
+			"RAM", "RAM req", "RAM lim", "RAM efficiency", "Findings"},
+	}
+	if currency != "" {
+		table.Columns = append(table.Columns, "Idle cost")
+	}
+	for _, pod := range pods {
+		findings := append(append([]string{}, pod.CPU.Findings...), pod.Memory.Findings...)
+		for _, finding := range pod.PolicyFindings {
+			findings = append(findings, finding.Rule)
+		}
+		usage := func(value float64, format string) htmlCell {
+			if !pod.Processed {
+				return htmlCell{Text: "-", Value: "-1"}
+			}
+			return numberCell(value, format)
+		}
+		cells := []htmlCell{
+			{Text: pod.Namespace},
+			{Text: pod.Name},
+			{Text: pod.WorkloadKind + "/" + pod.Workload},
+			{Text: pod.Team},
+			{Text: pod.QOSClass},
+			usage(pod.CPU.Usage, "%.1fm"),
+			numberCell(pod.CPU.Requests, "%.0fm"),
+			numberCell(pod.CPU.Limits, "%.0fm"),
+			usage(pod.CPU.Efficiency*100, "%.0f%%"),
+			usage(pod.Memory.Usage, "%.1fMi"),
+			numberCell(pod.Memory.Requests, "%.0fMi"),
+			numberCell(pod.Memory.Limits, "%.0fMi"),
+			usage(pod.Memory.Efficiency*100, "%.0f%%"),
+			{Text: strings.Join(findings, ", ")},
+		}
+		if currency != "" {
+			// Currency is configured by user, so it is never a part of format
+			cells = append(cells, htmlCell{Text: fmt.Sprintf("%s%.2f", currency, pod.MonthlyCost.Idle), Value: formatFloat(pod.MonthlyCost.Idle)})
+		}
+		table.Rows = append(table.Rows, cells)
+	}
+	return table
+}
+
+// htmlWorkload
+// Totals of workload pods with metrics
+type htmlWorkload struct {
+	Namespace              string
+	Workload               string
+	Team                   string
+	Pods                   int
+	CPUUsage               float64
+	CPURequests            float64
+	CPURecommendedRequests float64
+	RAMUsage               float64
+	RAMRequests            float64
+	RAMRecommendedRequests float64
+}
+
+// workloadsTable returns pods with metrics grouped by workload, recommended requests are multiplied by pods
+func workloadsTable(id string, pods []ExportPod) htmlTable {
+	var workloads []htmlWorkload
+	index := map[string]int{}
+	for _, pod := range pods {
+		if !pod.Processed {
+			continue
+		}
+		key := workloadKey(pod.Namespace, pod.WorkloadKind, pod.Workload)
+		i, ok := index[key]
+		if !ok {
+			workloads = append(workloads, htmlWorkload{
+				Namespace: pod.Namespace,
+				Workload:  pod.WorkloadKind + "/" + pod.Workload,
+				Team:      pod.Team,
+			})
+			i = len(workloads) - 1
+			index[key] = i
+		}
+		workload := &workloads[i]
+		workload.Pods++
+		workload.CPUUsage += pod.CPU.Usage
+		workload.CPURequests += pod.CPU.Requests
+		workload.CPURecommendedRequests += pod.CPU.RecommendedRequests
+		workload.RAMUsage += pod.Memory.Usage
+		workload.RAMRequests += pod.Memory.Requests
+		workload.RAMRecommendedRequests += pod.Memory.RecommendedRequests
+	}
+
+	table := htmlTable{
+		ID:      id,
+		Title:   "Workloads",
+		Columns: []string{"Ns", "Workload", "Team", "Pods", "CPU", "CPU req", "CPU recommended", "RAM", "RAM req", "RAM recommended"},
+	}
+	recommended := func(value float64, format string) htmlCell {
+		if value == 0 {
+			return htmlCell{Text: "-", Value: "-1"}
+		}
+		return numberCell(value, format)
+	}
+	for _, workload := range workloads {
+		table.Rows = append(table.Rows, []htmlCell{
+			{Text: workload.Namespace},
+			{Text: workload.Workload},
+			{Text: workload.Team},
+			numberCell(float64(workload.Pods), "%.0f"),
+			numberCell(workload.CPUUsage, "%.1fm"),
+			numberCell(workload.CPURequests, "%.0fm"),
+			recommended(workload.CPURecommendedRequests, "%.0fm"),
+			numberCell(workload.RAMUsage, "%.1fMi"),
+			numberCell(workload.RAMRequests, "%.0fMi"),
+			recommended(workload.RAMRecommendedRequests, "%.0fMi"),
+		})
+	}
+	return table
+}
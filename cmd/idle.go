@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"math"
+	"sort"
+	"time"
+)
+
+// IdleOptions
+// Thresholds of idle workloads, all pods of workload must be below them
+type IdleOptions struct {
+	CPU       float64 // Peak CPU usage, millicores
+	RAMGrowth float64 // Absolute working set trend, Mi per day
+	Network   float64 // Average receive and transmit rate, bytes per second, 0 - traffic is not checked
+}
+
+func DefaultIdleOptions() IdleOptions {
+	return IdleOptions{
+		CPU:       5,
+		RAMGrowth: 1,
+	}
+}
+
+// IdleWorkload
+// Workload without any activity over the window
+type IdleWorkload struct {
+	Namespace    string
+	WorkloadKind string
+	Workload     string
+	Team         string
+	Pods         int
+	CreatedAt    time.Time // Creation of the oldest pod
+	CPUUsage     float64
+	RAMUsage     float64
+	CPURequests  float64
+	RAMRequests  float64
+}
+
+type IdleWorkloadByAgeDesc []IdleWorkload
+
+// Idle returns true, if pod has no activity. Network and working set trend are checked only if source provides them
+func (pod *PodInfo) Idle(options IdleOptions, network bool, trend bool) bool {
+	if pod.CPUMetric > options.CPU {
+		return false
+	}
+	if network && options.Network > 0 && pod.NetRxRate+pod.NetTxRate > options.Network {
+		return false
+	}
+	for _, container := range pod.Containers {
+		if container.Restarts > 0 || trend && math.Abs(container.WorkingSetGrowth) > options.RAMGrowth {
+			return false
+		}
+	}
+	return true
+}
+
+// Finished returns true, if all containers of pod have terminated and will not be restarted
+func (pod *PodInfo) Finished() bool {
+	return pod.Phase == string(corev1.PodSucceeded) || pod.Phase == string(corev1.PodFailed)
+}
+
+// IdleWorkloads
+// Returns workloads whose pods are all idle, the oldest are the first
+func IdleWorkloads(pods []PodInfo, options IdleOptions, network bool, trend bool) []IdleWorkload {
+	var workloads []IdleWorkload
+	index := map[string]int{}
+	active := map[string]bool{}
+	for _, pod := range pods {
+		// Finished pods and jobs have no usage, but they are not zombies
+		if pod.Finished() || pod.WorkloadKind == "Job" || pod.WorkloadKind == "CronJob" || pod.Ignored[IgnoreIdle] {
+			continue
+		}
+		key := workloadKey(pod.Namespace, pod.WorkloadKind, pod.Workload)
+		if !pod.Idle(options, network, trend) {
+			active[key] = true
+			continue
+		}
+		i, ok := index[key]
+		if !ok {
+			workloads = append(workloads, IdleWorkload{
+				Namespace:    pod.Namespace,
+				WorkloadKind: pod.WorkloadKind,
+				Workload:     pod.Workload,
+				Team:         pod.Team,
+				CreatedAt:    pod.CreatedAt,
+			})
+			i = len(workloads) - 1
+			index[key] = i
+		}
+		workload := &workloads[i]
+		workload.Pods++
+		if pod.CreatedAt.Before(workload.CreatedAt) {
+			workload.CreatedAt = pod.CreatedAt
+		}
+		workload.CPUUsage += pod.CPUMetric
+		workload.RAMUsage += pod.RAMMetric
+		workload.CPURequests += pod.CPURequsts
+		workload.RAMRequests += pod.RAMRequests
+	}
+
+	var idle []IdleWorkload
+	for _, workload := range workloads {
+		if !active[workloadKey(workload.Namespace, workload.WorkloadKind, workload.Workload)] {
+			idle = append(idle, workload)
+		}
+	}
+	sort.Sort(IdleWorkloadByAgeDesc(idle))
+	return idle
+}
+
+// Age returns age of workload in days
+func (workload *IdleWorkload) Age(now time.Time) float64 {
+	if workload.CreatedAt.IsZero() {
+		return 0
+	}
+	return now.Sub(workload.CreatedAt).Hours() / 24
+}
+
+// Sorting idle workloads, the oldest are the first
+func (workloads IdleWorkloadByAgeDesc) Len() int { return len(workloads) }
+
+func (workloads IdleWorkloadByAgeDesc) Less(i, j int) bool {
+	return workloads[i].CreatedAt.Before(workloads[j].CreatedAt)
+}
+
+func (workloads IdleWorkloadByAgeDesc) Swap(i, j int) {
+	workloads[i], workloads[j] = workloads[j], workloads[i]
+}
@@ -3,17 +3,22 @@ package cmd
 import (
 	"context"
 	log "github.com/sirupsen/logrus"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"sort"
 	"strings"
+	"time"
 )
 
 type KubeCluster struct {
-	Cluster string
-	Config  *rest.Config
+	Cluster        string
+	Config         *rest.Config
+	AllocatableCPU float64 // Sum of nodes allocatable, millicores. Filled by ReturnPods
+	AllocatableRAM float64 // Mi
 }
 
 func (kub *KubeCluster) AuthRemote(configFile []byte) error {
@@ -34,7 +39,7 @@ func (kub *KubeCluster) AuthLocal() error {
 	return nil
 }
 
-func (kub *KubeCluster) ReturnPods(namespacesExclude []string, logger *log.Entry) ([]PodInfo, error) {
+func (kub *KubeCluster) ReturnPods(ctx context.Context, namespacesExclude []string, logger *log.Entry) ([]PodInfo, error) {
 
 	var podsReport []PodInfo
 	var tempPod PodInfo
@@ -44,7 +49,7 @@ func (kub *KubeCluster) ReturnPods(namespacesExclude []string, logger *log.Entry
 		return nil, err
 	}
 	logger.Infof("Trying to get namespaces from kubernetes")
-	namespaces, err := clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{
+	namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
 		TypeMeta:             metav1.TypeMeta{},
 		LabelSelector:        "",
 		Watch:                false,
@@ -60,6 +65,19 @@ func (kub *KubeCluster) ReturnPods(namespacesExclude []string, logger *log.Entry
 		return nil, err
 	}
 
+	nodeLabels := map[string]map[string]string{}
+	kub.AllocatableCPU, kub.AllocatableRAM = 0, 0
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		logger.Warnf("Cannot list nodes, node pool prices are ignored: %v", err)
+	} else {
+		for _, node := range nodes.Items {
+			nodeLabels[node.Name] = node.Labels
+			kub.AllocatableCPU += float64(node.Status.Allocatable.Cpu().MilliValue())
+			kub.AllocatableRAM += float64(node.Status.Allocatable.Memory().Value() / 1024 / 1024)
+		}
+	}
+
 	for _, namespace := range namespaces.Items {
 
 		// Exclude ns from list
@@ -69,29 +87,74 @@ func (kub *KubeCluster) ReturnPods(namespacesExclude []string, logger *log.Entry
 			continue
 		}
 
+		namespaceSuppression, err := ParseSuppression("Namespace", namespace.Name, namespace.Name, namespace.Annotations)
+		if err != nil {
+			logger.Warnf("Invalid suppression: %v", err)
+		}
+		jobs, jobsErr := clientset.BatchV1().Jobs(namespace.Name).List(ctx, metav1.ListOptions{})
+		if jobsErr != nil {
+			logger.Warnf("Cannot list Jobs in namespace %s, their suppressions are ignored and their pods are not resolved to CronJobs: %v", namespace.Name, jobsErr)
+			jobs = &batchv1.JobList{}
+		}
+		workloadSuppressions := workloadSuppressions(ctx, clientset, namespace.Name, jobs.Items, logger)
+		cronJobs := jobCronJobs(jobs.Items)
+
 		logger.Debugf("Trying to get pods from from namespace %v", namespace.Name)
-		pods, err := clientset.CoreV1().Pods(namespace.Name).List(context.TODO(), metav1.ListOptions{})
-		logger.Debugf("I found %d pods in namespace %v", len(pods.Items), namespace.Name)
+		pods, err := clientset.CoreV1().Pods(namespace.Name).List(ctx, metav1.ListOptions{})
 		if err != nil {
 			return nil, err
 		}
+		logger.Debugf("I found %d pods in namespace %v", len(pods.Items), namespace.Name)
 
 		for _, pod := range pods.Items {
-			tempPod.CPULimits = 0
-			tempPod.RAMLimits = 0
-			tempPod.CPURequsts = 0
-			tempPod.RAMRequests = 0
+			tempPod = PodInfo{}
 
 			logger.Debugf("Filling info for pod  %v", pod.Name)
 			tempPod.Name = pod.Name
 			tempPod.Uid = strings.Replace(string(pod.UID), "-", "_", -1)
 			tempPod.Namespace = namespace.Name
 			tempPod.Application = pod.Labels["app"]
+			tempPod.WorkloadKind, tempPod.Workload = podWorkload(&pod, cronJobs)
+			tempPod.Labels = pod.Labels
+			tempPod.NamespaceLabels = namespace.Labels
+			tempPod.NodeLabels = nodeLabels[pod.Spec.NodeName]
+			if namespaceSuppression != nil {
+				tempPod.Suppressions = append(tempPod.Suppressions, *namespaceSuppression)
+			}
+			if suppression, ok := workloadSuppressions[tempPod.WorkloadKind+"/"+tempPod.Workload]; ok {
+				tempPod.Suppressions = append(tempPod.Suppressions, suppression)
+			}
+			podSuppression, err := ParseSuppression("Pod", namespace.Name, pod.Name, pod.Annotations)
+			if err != nil {
+				logger.Warnf("Invalid suppression: %v", err)
+			}
+			if podSuppression != nil {
+				tempPod.Suppressions = append(tempPod.Suppressions, *podSuppression)
+			}
 			for _, cnt := range pod.Spec.Containers {
-				tempPod.CPULimits += float64(cnt.Resources.Limits.Cpu().MilliValue())
-				tempPod.RAMLimits += float64(cnt.Resources.Limits.Memory().MilliValue() / 1000 / 1024 / 1024)
-				tempPod.CPURequsts += float64(cnt.Resources.Requests.Cpu().MilliValue())
-				tempPod.RAMRequests += float64(cnt.Resources.Requests.Memory().MilliValue() / 1000 / 1024 / 1024)
+				container := ContainerInfo{
+					Name:        cnt.Name,
+					CPULimits:   float64(cnt.Resources.Limits.Cpu().MilliValue()),
+					RAMLimits:   float64(cnt.Resources.Limits.Memory().MilliValue() / 1000 / 1024 / 1024),
+					CPURequsts:  float64(cnt.Resources.Requests.Cpu().MilliValue()),
+					RAMRequests: float64(cnt.Resources.Requests.Memory().MilliValue() / 1000 / 1024 / 1024),
+				}
+				tempPod.CPULimits += container.CPULimits
+				tempPod.RAMLimits += container.RAMLimits
+				tempPod.CPURequsts += container.CPURequsts
+				tempPod.RAMRequests += container.RAMRequests
+				tempPod.Containers = append(tempPod.Containers, container)
+			}
+			tempPod.QOSClass = podQOSClass(&pod)
+			tempPod.Phase = string(pod.Status.Phase)
+			tempPod.CreatedAt = pod.CreationTimestamp.Time
+			for _, status := range pod.Status.ContainerStatuses {
+				for i := range tempPod.Containers {
+					if tempPod.Containers[i].Name == status.Name {
+						tempPod.Containers[i].Restarts = status.RestartCount
+						tempPod.Containers[i].OOMKilledAt = oomKilledAt(status)
+					}
+				}
 			}
 			podsReport = append(podsReport, tempPod)
 		}
@@ -99,3 +162,137 @@ func (kub *KubeCluster) ReturnPods(namespacesExclude []string, logger *log.Entry
 	logger.Debug("Pod structure complete")
 	return podsReport, nil
 }
+
+// oomKilledAt returns time of the last OOM kill of container, zero if it was not killed
+func oomKilledAt(status corev1.ContainerStatus) time.Time {
+	for _, state := range []corev1.ContainerState{status.State, status.LastTerminationState} {
+		if state.Terminated != nil && state.Terminated.Reason == "OOMKilled" {
+			return state.Terminated.FinishedAt.Time
+		}
+	}
+	return time.Time{}
+}
+
+// podQOSClass returns QoS class from pod status, or calculates it for pods which are not scheduled yet
+func podQOSClass(pod *corev1.Pod) string {
+	if pod.Status.QOSClass != "" {
+		return string(pod.Status.QOSClass)
+	}
+	requests, limits, guaranteed := false, false, true
+	for _, container := range pod.Spec.Containers {
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			request, hasRequest := container.Resources.Requests[name]
+			limit, hasLimit := container.Resources.Limits[name]
+			requests = requests || hasRequest
+			limits = limits || hasLimit
+			// Requests default to limits
+			if !hasLimit || (hasRequest && request.Cmp(limit) != 0) {
+				guaranteed = false
+			}
+		}
+	}
+	switch {
+	case !requests && !limits:
+		return string(corev1.PodQOSBestEffort)
+	case guaranteed:
+		return string(corev1.PodQOSGuaranteed)
+	}
+	return string(corev1.PodQOSBurstable)
+}
+
+// workloadSuppressions returns suppressions of workloads in namespace by kind/name, jobs are listed by caller.
+// Workloads which cannot be listed are skipped, so missing permissions only disable their suppressions
+func workloadSuppressions(ctx context.Context, clientset *kubernetes.Clientset, namespace string, jobs []batchv1.Job, logger *log.Entry) map[string]Suppression {
+	suppressions := map[string]Suppression{}
+	add := func(kind string, objects []metav1.ObjectMeta, err error) {
+		if err != nil {
+			logger.Warnf("Cannot list %ss in namespace %s, their suppressions are ignored: %v", kind, namespace, err)
+			return
+		}
+		for _, object := range objects {
+			suppression, err := ParseSuppression(kind, namespace, object.Name, object.Annotations)
+			if err != nil {
+				logger.Warnf("Invalid suppression: %v", err)
+			}
+			if suppression != nil {
+				suppressions[kind+"/"+object.Name] = *suppression
+			}
+		}
+	}
+
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	var objects []metav1.ObjectMeta
+	if err == nil {
+		for _, item := range deployments.Items {
+			objects = append(objects, item.ObjectMeta)
+		}
+	}
+	add("Deployment", objects, err)
+
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	objects = nil
+	if err == nil {
+		for _, item := range statefulSets.Items {
+			objects = append(objects, item.ObjectMeta)
+		}
+	}
+	add("StatefulSet", objects, err)
+
+	daemonSets, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	objects = nil
+	if err == nil {
+		for _, item := range daemonSets.Items {
+			objects = append(objects, item.ObjectMeta)
+		}
+	}
+	add("DaemonSet", objects, err)
+
+	objects = nil
+	for _, item := range jobs {
+		objects = append(objects, item.ObjectMeta)
+	}
+	add("Job", objects, nil)
+
+	cronJobs, err := clientset.BatchV1beta1().CronJobs(namespace).List(ctx, metav1.ListOptions{})
+	objects = nil
+	if err == nil {
+		for _, item := range cronJobs.Items {
+			objects = append(objects, item.ObjectMeta)
+		}
+	}
+	add("CronJob", objects, err)
+	return suppressions
+}
+
+// jobCronJobs returns names of CronJobs which control jobs by Job name
+func jobCronJobs(jobs []batchv1.Job) map[string]string {
+	cronJobs := map[string]string{}
+	for _, job := range jobs {
+		if owner := metav1.GetControllerOf(&job); owner != nil && owner.Kind == "CronJob" {
+			cronJobs[job.Name] = owner.Name
+		}
+	}
+	return cronJobs
+}
+
+// podWorkload returns kind and name of workload which controls pod.
+// ReplicaSets created by deployments are resolved to the deployment by pod template hash,
+// Jobs created by CronJobs are resolved to the CronJob by cronJobs, Job name to CronJob name
+func podWorkload(pod *corev1.Pod, cronJobs map[string]string) (string, string) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "Pod", pod.Name
+	}
+	if owner.Kind == "ReplicaSet" {
+		hash := pod.Labels["pod-template-hash"]
+		if hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+			return "Deployment", strings.TrimSuffix(owner.Name, "-"+hash)
+		}
+	}
+	if owner.Kind == "Job" {
+		if cronJob, ok := cronJobs[owner.Name]; ok {
+			return "CronJob", cronJob
+		}
+	}
+	return owner.Kind, owner.Name
+}
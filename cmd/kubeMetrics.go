@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	metrics "k8s.io/metrics/pkg/client/clientset/versioned"
+	"time"
+)
+
+// KubeMetrics
+// MetricsSource implementation for metrics.k8s.io, for clusters without Prometheus.
+// Metrics server knows only current usage, so all statistics are point-in-time
+type KubeMetrics struct {
+	clients  map[string]*metrics.Clientset
+	evalTime time.Time
+}
+
+func CreateKubeMetrics(datacenters []Datacenter) (*KubeMetrics, error) {
+	source := KubeMetrics{
+		clients:  map[string]*metrics.Clientset{},
+		evalTime: time.Now(),
+	}
+	for _, dc := range datacenters {
+		config, err := clientcmd.RESTConfigFromKubeConfig(dc.KubeConfig)
+		if err != nil {
+			return nil, err
+		}
+		client, err := metrics.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		source.clients[dc.Name] = client
+	}
+	return &source, nil
+}
+
+func (source *KubeMetrics) EvalTime() time.Time {
+	return source.evalTime
+}
+
+func (source *KubeMetrics) Options() MetricsOptions {
+	return MetricsOptions{MemoryMetrics: []string{"working_set"}, PointInTime: true, Average: true}
+}
+
+func (source *KubeMetrics) PodUsage(ctx context.Context, dc string, pod *PodInfo) (*PodUsage, error) {
+	client, ok := source.clients[dc]
+	if !ok {
+		return nil, fmt.Errorf("no metrics client for dc %s", dc)
+	}
+	podMetrics, err := client.MetricsV1beta1().PodMetricses(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// Pending, just started and finished pods have no metrics
+		return nil, fmt.Errorf("%w: %v", ErrNoMetrics, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	usage := PodUsage{Containers: map[string]ContainerUsage{}}
+	for _, container := range podMetrics.Containers {
+		containerUsage := ContainerUsage{
+			CPU: float64(container.Usage.Cpu().MilliValue()) / 1000,
+			RAM: float64(container.Usage.Memory().Value()),
+		}
+		// There is no history, so trend is flat and peak is current usage
+		containerUsage.WorkingSetPeak = containerUsage.RAM
+		containerUsage.WorkingSet = []Sample{{Time: podMetrics.Timestamp.Time, Value: containerUsage.RAM}}
+		usage.CPU += containerUsage.CPU
+		usage.RAM += containerUsage.RAM
+		usage.Containers[container.Name] = containerUsage
+	}
+	// Metrics server reports working set as memory usage, current usage is the only estimate of average
+	usage.WorkingSet = usage.RAM
+	usage.CPUAverage, usage.RAMAverage = usage.CPU, usage.RAM
+	return &usage, nil
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// QueryLimiter
+// Shared between all workers, protects metrics backend from bursts of heavy queries
+type QueryLimiter struct {
+	qps        *rate.Limiter
+	budget     *rate.Limiter
+	resolution time.Duration
+	holdUntil  time.Time
+	mutex      sync.Mutex
+	logger     *log.Entry
+}
+
+// Matches range selectors and subqueries, like [7d] or [7d:1m]
+var rangeSelectorRegexp = regexp.MustCompile(`\[(\d+[smhdwy])(?::(\d+[smhdwy])?)?\]`)
+
+// CreateLimiter
+// qps and budget <= 0 disable corresponding limit, resolution is the step used for range selectors without explicit one
+func CreateLimiter(qps float64, burst int, budget float64, resolution time.Duration, logger *log.Entry) *QueryLimiter {
+	limiter := QueryLimiter{
+		qps:        rate.NewLimiter(rate.Inf, 0),
+		budget:     rate.NewLimiter(rate.Inf, 0),
+		resolution: resolution,
+		logger:     logger,
+	}
+	if qps > 0 {
+		if burst < 1 {
+			burst = 1
+		}
+		limiter.qps = rate.NewLimiter(rate.Limit(qps), burst)
+	}
+	if budget > 0 {
+		// Burst of 0 would reject every query, so fractional budgets allow at least one point at once
+		limiter.budget = rate.NewLimiter(rate.Limit(budget), int(math.Max(1, math.Ceil(budget))))
+	}
+	if limiter.resolution <= 0 {
+		limiter.resolution = time.Minute
+	}
+	return &limiter
+}
+
+// Wait
+// Blocks until query of cost points is allowed to be sent
+func (limiter *QueryLimiter) Wait(ctx context.Context, cost int) error {
+	limiter.mutex.Lock()
+	hold := time.Until(limiter.holdUntil)
+	limiter.mutex.Unlock()
+
+	if hold > 0 {
+		limiter.logger.Debugf("Backend asked to slow down, waiting %s", hold)
+		timer := time.NewTimer(hold)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	// Queries heavier than burst are charged in chunks, so they wait for their full cost
+	if limiter.budget.Limit() != rate.Inf {
+		for cost > 0 {
+			chunk := cost
+			if chunk > limiter.budget.Burst() {
+				chunk = limiter.budget.Burst()
+			}
+			if err := limiter.budget.WaitN(ctx, chunk); err != nil {
+				return err
+			}
+			cost -= chunk
+		}
+	}
+	return limiter.qps.Wait(ctx)
+}
+
+// Hold
+// Stops sending queries from all workers until deadline
+func (limiter *QueryLimiter) Hold(duration time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	until := time.Now().Add(duration)
+	if until.After(limiter.holdUntil) {
+		limiter.holdUntil = until
+	}
+}
+
+// Cost
+// Estimates query weight as amount of points which backend has to evaluate
+func (limiter *QueryLimiter) Cost(query string) int {
+	cost := 0
+	for _, match := range rangeSelectorRegexp.FindAllStringSubmatch(query, -1) {
+		window, err := parsePromDuration(match[1])
+		if err != nil {
+			continue
+		}
+		step := limiter.resolution
+		if match[2] != "" {
+			if parsed, err := parsePromDuration(match[2]); err == nil && parsed > 0 {
+				step = parsed
+			}
+		}
+		cost += int(window / step)
+	}
+	if cost < 1 {
+		cost = 1
+	}
+	return cost
+}
+
+// RangeCost
+// Estimates range query weight, query is evaluated at every step of the window
+func (limiter *QueryLimiter) RangeCost(query string, window time.Duration, step time.Duration) int {
+	steps := 1
+	if step > 0 && window > step {
+		steps = int(window / step)
+	}
+	return limiter.Cost(query) * steps
+}
+
+// parsePromDuration parses prometheus durations, which unlike go durations know about days, weeks and years
+func parsePromDuration(value string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		's': time.Second,
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+		'y': 365 * 24 * time.Hour,
+	}
+	number, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(number) * units[value[len(value)-1]], nil
+}
+
+// parseRetryAfter parses Retry-After header, which can be delay in seconds or HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
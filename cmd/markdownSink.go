@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MarkdownSink
+// Writes report as GitHub-flavoured Markdown to file or stdout, or to one file per team in directory
+type MarkdownSink struct {
+	path       string
+	splitTeams bool
+	rows       int
+}
+
+func CreateMarkdownSink(path string, splitTeams bool, rows int) *MarkdownSink {
+	return &MarkdownSink{
+		path:       path,
+		splitTeams: splitTeams,
+		rows:       rows,
+	}
+}
+
+func (sink *MarkdownSink) Name() string {
+	return "markdown"
+}
+
+// Write
+// Writes the whole report, or report of every team to <path>/<team>.md
+func (sink *MarkdownSink) Write(ctx context.Context, report *Report) error {
+	if !sink.splitTeams {
+		return sink.writeFile(sink.path, report)
+	}
+	if err := os.MkdirAll(sink.path, 0755); err != nil {
+		return err
+	}
+	teams := report.Teams()
+	names := teamFileNames(teams)
+	for _, team := range teams {
+		if err := sink.writeFile(filepath.Join(sink.path, names[team]+".md"), report.ForTeam(team)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sink *MarkdownSink) writeFile(path string, report *Report) error {
+	output, err := openOutput(path)
+	if err != nil {
+		return err
+	}
+	if err := RenderMarkdown(output, report, sink.rows); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
+
+var fileNameReplacer = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// teamFileName returns team name which is safe for file name
+func teamFileName(team string) string {
+	name := strings.Trim(fileNameReplacer.ReplaceAllString(team, "-"), ".-")
+	if name == "" {
+		return "unassigned"
+	}
+	return name
+}
+
+// teamFileNames returns file names of teams. Teams whose names are the same after replacing unsafe characters,
+// ignoring case, get short hash of team name appended, so their reports never overwrite each other
+func teamFileNames(teams []string) map[string]string {
+	count := map[string]int{}
+	for _, team := range teams {
+		count[strings.ToLower(teamFileName(team))]++
+	}
+	names := map[string]string{}
+	for _, team := range teams {
+		name := teamFileName(team)
+		if count[strings.ToLower(name)] > 1 {
+			hash := fnv.New32a()
+			hash.Write([]byte(team))
+			name = fmt.Sprintf("%s-%08x", name, hash.Sum32())
+		}
+		names[team] = name
+	}
+	return names
+}
+
+// RenderMarkdown
+// Renders report as Markdown, sections are truncated to rows, 0 - all rows
+func RenderMarkdown(writer io.Writer, report *Report, rows int) error {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "# %s\n\n", markdownText(report.Title))
+	fmt.Fprintf(&builder, "Generated %s, data as of %s, %s\n\n",
+		report.GeneratedAt.UTC().Format("2006-01-02 15:04 MST"), report.EvalTime.UTC().Format("2006-01-02 15:04 MST"), report.UsageNote())
+	if report.Partial() {
+		fmt.Fprintf(&builder, "> **Warning:** partial report, metrics were received for %d of %d pods\n\n", report.Processed, report.Total)
+	}
+
+	for _, dc := range report.Datacenters {
+		fmt.Fprintf(&builder, "## Datacenter %s\n\n", markdownText(strings.ToUpper(dc.Name)))
+		writeMarkdownSummary(&builder, dc.Summary)
+		for _, section := range dc.Sections {
+			writeMarkdownSection(&builder, section, rows)
+		}
+
+		// Pods by namespace
+		var namespaces []string
+		byNamespace := map[string][]PodInfo{}
+		for _, pod := range dc.Pods {
+			if _, ok := byNamespace[pod.Namespace]; !ok {
+				namespaces = append(namespaces, pod.Namespace)
+			}
+			byNamespace[pod.Namespace] = append(byNamespace[pod.Namespace], pod)
+		}
+		sort.Strings(namespaces)
+		for _, namespace := range namespaces {
+			fmt.Fprintf(&builder, "### Namespace %s\n\n", markdownText(namespace))
+			writeMarkdownTable(&builder, namespacePodColumns, namespacePodRows(byNamespace[namespace]))
+		}
+	}
+
+	for _, section := range report.Appendix {
+		writeMarkdownSection(&builder, section, rows)
+	}
+	_, err := io.WriteString(writer, builder.String())
+	return err
+}
+
+// writeMarkdownSummary writes totals of datacenter, overcommit is written if allocatable resources are known
+func writeMarkdownSummary(builder *strings.Builder, summary Summary) {
+	fmt.Fprintf(builder, "- **Pods:** %d (%d with metrics), without requests: %d, without limits: %d\n",
+		summary.Pods, summary.ProcessedPods, summary.WithoutRequests, summary.WithoutLimits)
+	fmt.Fprintf(builder, "- **CPU:** used %.0fm of %.0fm requested (%.1f%%) and %.0fm limited (%.1f%%)\n",
+		summary.CPUUsage, summary.CPURequests, summary.CPURequestsUtilisation()*100, summary.CPULimits, summary.CPULimitsUtilisation()*100)
+	fmt.Fprintf(builder, "- **RAM:** used %.0fMi of %.0fMi requested (%.1f%%) and %.0fMi limited (%.1f%%)\n",
+		summary.RAMUsage, summary.RAMRequests, summary.RAMRequestsUtilisation()*100, summary.RAMLimits, summary.RAMLimitsUtilisation()*100)
+	if summary.AllocatableCPU > 0 || summary.AllocatableRAM > 0 {
+		fmt.Fprintf(builder, "- **Limits to allocatable:** CPU %.0f%%, RAM %.0f%%\n", summary.CPUOvercommit()*100, summary.RAMOvercommit()*100)
+	}
+	fmt.Fprintf(builder, "- **QoS:** %s\n", formatClasses(summary.QOSClasses))
+	fmt.Fprintf(builder, "- **CPU pods:** %s\n", formatClasses(summary.CPUClasses))
+	fmt.Fprintf(builder, "- **RAM pods:** %s\n\n", formatClasses(summary.RAMClasses))
+}
+
+// truncateSection returns section title and its first rows, 0 - all rows
+func truncateSection(section Section, rows int) (string, [][]string) {
+	if rows > 0 && len(section.Rows) > rows {
+		return section.Title + fmt.Sprintf(" (top %d of %d)", rows, len(section.Rows)), section.Rows[:rows]
+	}
+	return section.Title, section.Rows
+}
+
+// writeMarkdownSection writes section title and its first rows
+func writeMarkdownSection(builder *strings.Builder, section Section, rows int) {
+	title, sectionRows := truncateSection(section, rows)
+	fmt.Fprintf(builder, "### %s\n\n", markdownText(title))
+	if len(sectionRows) == 0 {
+		builder.WriteString("No pods found\n\n")
+		return
+	}
+	writeMarkdownTable(builder, section.Columns, sectionRows)
+}
+
+// writeMarkdownTable writes GitHub-flavoured Markdown table
+func writeMarkdownTable(builder *strings.Builder, columns []string, rows [][]string) {
+	separators := make([]string, len(columns))
+	for i := range columns {
+		separators[i] = "---"
+	}
+	writeMarkdownRow(builder, columns)
+	writeMarkdownRow(builder, separators)
+	for _, row := range rows {
+		writeMarkdownRow(builder, row)
+	}
+	builder.WriteString("\n")
+}
+
+func writeMarkdownRow(builder *strings.Builder, cells []string) {
+	builder.WriteString("|")
+	for _, cell := range cells {
+		builder.WriteString(" " + markdownText(cell) + " |")
+	}
+	builder.WriteString("\n")
+}
+
+var markdownReplacer = strings.NewReplacer("\\", "\\\\", "|", "\\|", "*", "\\*", "_", "\\_", "`", "\\`", "<", "&lt;", ">", "&gt;", "\r", " ", "\n", " ")
+
+// markdownText escapes text, so it is not formatted and does not break tables
+func markdownText(text string) string {
+	return markdownReplacer.Replace(text)
+}
+
+var namespacePodColumns = []string{"Pod", "Workload", "Team", "QoS", "CPU", "CPU req", "CPU lim", "RAM", "RAM req", "RAM lim", "Findings"}
+
+// namespacePodRows returns rows of pods, usage of pods without metrics is unknown
+func namespacePodRows(pods []PodInfo) [][]string {
+	var rows [][]string
+	for _, pod := range pods {
+		cpu, ram := "-", "-"
+		if pod.Processed {
+			cpu = fmt.Sprintf("%.1fm", pod.CPUMetric)
+			ram = fmt.Sprintf("%.1fMi", pod.RAMMetric)
+		}
+		findings := append(pod.CPUScore.Findings.Names(), pod.RAMScore.Findings.Names()...)
+		for _, finding := range pod.PolicyFindings {
+			findings = append(findings, finding.Rule)
+		}
+		rows = append(rows, []string{
+			pod.Name,
+			pod.WorkloadKind + "/" + pod.Workload,
+			pod.Team,
+			pod.QOSClass,
+			cpu,
+			fmt.Sprintf("%.0fm", pod.CPURequsts),
+			fmt.Sprintf("%.0fm", pod.CPULimits),
+			ram,
+			fmt.Sprintf("%.0fMi", pod.RAMRequests),
+			fmt.Sprintf("%.0fMi", pod.RAMLimits),
+			strings.Join(findings, ", "),
+		})
+	}
+	return rows
+}
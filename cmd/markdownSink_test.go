@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTeamFileNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		teams []string
+		plain []string // Teams whose file name has no hash
+	}{
+		{"distinct teams", []string{"payments", "search"}, []string{"payments", "search"}},
+		{"space and dash", []string{"team a", "team-a", "search"}, []string{"search"}},
+		{"unassigned and empty team", []string{"", "unassigned"}, nil},
+		{"case only", []string{"Team", "team"}, nil},
+		{"unsafe characters", []string{"ops/infra"}, []string{"ops/infra"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names := teamFileNames(test.teams)
+			seen := map[string]string{}
+			for _, team := range test.teams {
+				name := names[team]
+				if other, ok := seen[strings.ToLower(name)]; ok {
+					t.Errorf("teams %q and %q have the same file name %q", team, other, name)
+				}
+				seen[strings.ToLower(name)] = team
+				if !strings.HasPrefix(name, teamFileName(team)) {
+					t.Errorf("file name of team %q is %q, expected prefix %q", team, name, teamFileName(team))
+				}
+			}
+			for _, team := range test.plain {
+				if names[team] != teamFileName(team) {
+					t.Errorf("file name of team %q is %q, expected %q", team, names[team], teamFileName(team))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// MetricsSource
+// Returns usage statistics of pods, implemented by Prometheus compatible backends and metrics.k8s.io
+type MetricsSource interface {
+	// PodUsage returns usage of pod and its containers. Prometheus compatible backends return peaks over the window,
+	// point-in-time sources return current usage, see MetricsOptions.PointInTime.
+	// ErrNoMetrics means that source has no data for pod, it stays unprocessed and the report is partial
+	PodUsage(ctx context.Context, dc string, pod *PodInfo) (*PodUsage, error)
+	// EvalTime returns the moment when usage was evaluated
+	EvalTime() time.Time
+	// Options returns metric families which source really provides
+	Options() MetricsOptions
+}
+
+// MetricsOptions
+// Optional metric families, each of them costs additional queries per pod
+type MetricsOptions struct {
+	Throttling    bool
+	MemoryMetrics []string // Names from MemoryMetrics map, values are summed, see ValidateMemoryMetrics
+	Network       bool
+	Disk          bool
+	Percentile    float64 // Quantile of container usage for recommendations, 0 - peak usage
+	OOMPrediction bool    // Query working set series of containers for OOM prediction
+	PointInTime   bool    // Source knows current usage only, it is reported instead of peaks
+	Average       bool    // Query average usage over the window, it is used for cost estimation
+}
+
+// ErrNoMetrics
+// Source has no metrics for pod, e.g. metrics server for pending or just started pods
+var ErrNoMetrics = errors.New("no metrics for pod")
+
+// MemoryMetrics
+// Memory metrics which can be used for RAM usage
+var MemoryMetrics = map[string]string{
+	"working_set": "container_memory_working_set_bytes",
+	"rss":         "container_memory_rss",
+	"cache":       "container_memory_cache",
+}
+
+// ValidateMemoryMetrics
+// Checks that metrics are known and do not overlap. Working set already includes rss and the most of cache,
+// so it cannot be summed with them, only rss and cache are additive
+func ValidateMemoryMetrics(metrics []string) error {
+	seen := map[string]bool{}
+	for _, metric := range metrics {
+		if _, ok := MemoryMetrics[metric]; !ok {
+			return fmt.Errorf("unknown memory metric %s", metric)
+		}
+		if seen[metric] {
+			return fmt.Errorf("memory metric %s is repeated", metric)
+		}
+		seen[metric] = true
+	}
+	if seen["working_set"] && len(metrics) > 1 {
+		return errors.New("memory metric working_set includes rss and cache and cannot be summed with them")
+	}
+	return nil
+}
+
+// PodUsage
+// Usage statistics in base units - cores, bytes and bytes per second
+type PodUsage struct {
+	CPU          float64
+	RAM          float64
+	CPUAverage   float64
+	RAMAverage   float64
+	WorkingSet   float64
+	Throttling   float64
+	NetRx        float64
+	NetTx        float64
+	FsRead       float64
+	FsWrite      float64
+	CPUQuantiles map[string]float64
+	RAMQuantiles map[string]float64
+	Containers   map[string]ContainerUsage
+}
+
+type ContainerUsage struct {
+	CPU              float64
+	RAM              float64
+	WorkingSetPeak   float64  // Peak working set, bytes
+	WorkingSetGrowth float64  // Trend of working set, bytes per second. Used if series is not queried
+	WorkingSet       []Sample // Working set series, bytes
+}
+
+// Apply
+// Fills pod metrics from usage
+func (usage *PodUsage) Apply(pod *PodInfo) {
+	pod.UpdateMetrics(usage.CPU, usage.RAM)
+	pod.CPUAverage = usage.CPUAverage * 1000
+	pod.RAMAverage = usage.RAMAverage / 1024 / 1024
+	pod.RAMWorkingSet = usage.WorkingSet / 1024 / 1024
+	pod.CPUThrottling = usage.Throttling
+	pod.NetRxRate, pod.NetTxRate = usage.NetRx, usage.NetTx
+	pod.FsReadRate, pod.FsWriteRate = usage.FsRead, usage.FsWrite
+	for phi, value := range usage.CPUQuantiles {
+		pod.SetCPUQuantile(phi, value)
+	}
+	for phi, value := range usage.RAMQuantiles {
+		pod.SetRAMQuantile(phi, value)
+	}
+	for i := range pod.Containers {
+		if containerUsage, ok := usage.Containers[pod.Containers[i].Name]; ok {
+			pod.Containers[i].UpdateMetrics(containerUsage.CPU, containerUsage.RAM)
+			if len(containerUsage.WorkingSet) > 0 {
+				pod.Containers[i].SetWorkingSet(containerUsage.WorkingSet)
+			} else {
+				pod.Containers[i].WorkingSetGrowth = containerUsage.WorkingSetGrowth * 24 * 3600 / 1024 / 1024
+			}
+			pod.Containers[i].WorkingSetPeak = math.Max(pod.Containers[i].WorkingSetPeak, containerUsage.WorkingSetPeak/1024/1024)
+		}
+	}
+}
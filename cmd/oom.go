@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Window and resolution of working set series for OOM prediction
+const (
+	oomWindow = 7 * 24 * time.Hour
+	oomStep   = time.Hour
+)
+
+// Sample
+// Value of a series at a moment
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// OOMOptions
+// OOM risk prediction settings
+type OOMOptions struct {
+	Horizon time.Duration // Containers which reach limit within horizon are at risk
+	Recent  time.Duration // OOM kills within the period are recent
+	Usage   float64       // Containers with peak working set above this share of limit are at risk regardless of trend
+}
+
+func DefaultOOMOptions() OOMOptions {
+	return OOMOptions{
+		Horizon: 14 * 24 * time.Hour,
+		Recent:  oomWindow,
+		Usage:   0.9,
+	}
+}
+
+// OOMRisk
+// Risk of container to be killed by memory limit. Memory values are in Mi
+type OOMRisk struct {
+	Namespace   string
+	Pod         string
+	Container   string
+	WorkingSet  float64 // Peak working set
+	Limit       float64
+	Growth      float64       // Trend of working set, Mi per day
+	TimeToOOM   time.Duration // Time until trend reaches limit, negative if it never does
+	OOMKilledAt time.Time     // Last OOM kill, zero if there were none
+	Score       float64       // 0 - no risk, 1 - limit is reached or container was recently OOM killed
+}
+
+type OOMRiskByScoreDesc []OOMRisk
+
+// linearRegression returns slope per second and value of the trend line at the last sample
+func linearRegression(samples []Sample) (float64, float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	if len(samples) == 1 {
+		return 0, samples[0].Value
+	}
+	start := samples[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, sample := range samples {
+		x := sample.Time.Sub(start).Seconds()
+		sumX += x
+		sumY += sample.Value
+		sumXY += x * sample.Value
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, sumY / n
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	intercept := (sumY - slope*sumX) / n
+	last := samples[len(samples)-1].Time.Sub(start).Seconds()
+	return slope, intercept + slope*last
+}
+
+// SetWorkingSet
+// Calculates peak and trend of working set from samples in bytes
+func (container *ContainerInfo) SetWorkingSet(samples []Sample) {
+	container.WorkingSetPeak = 0
+	for _, sample := range samples {
+		container.WorkingSetPeak = math.Max(container.WorkingSetPeak, sample.Value/1024/1024)
+	}
+	slope, current := linearRegression(samples)
+	container.WorkingSetGrowth = slope * 24 * 3600 / 1024 / 1024
+	container.WorkingSetTrend = current / 1024 / 1024
+}
+
+// OOMRisk
+// Estimates OOM risk of container by peak working set, its trend and recent OOM kills
+func (container *ContainerInfo) OOMRisk(options OOMOptions, now time.Time) float64 {
+	risk := 0.0
+	if !container.OOMKilledAt.IsZero() && now.Sub(container.OOMKilledAt) <= options.Recent {
+		risk = 1
+	}
+	if container.RAMLimits <= 0 {
+		return risk
+	}
+	risk = math.Max(risk, math.Min(1, container.WorkingSetPeak/container.RAMLimits))
+	if timeToOOM := container.TimeToOOM(); timeToOOM >= 0 && timeToOOM < options.Horizon {
+		risk = math.Max(risk, 1-float64(timeToOOM)/float64(options.Horizon))
+	}
+	return risk
+}
+
+// TimeToOOM returns time until working set trend reaches limit, negative if it does not grow or limit is not set
+func (container *ContainerInfo) TimeToOOM() time.Duration {
+	if container.RAMLimits <= 0 || container.WorkingSetGrowth <= 0 {
+		return -1
+	}
+	days := (container.RAMLimits - math.Max(container.WorkingSetTrend, container.WorkingSetPeak)) / container.WorkingSetGrowth
+	if days <= 0 {
+		return 0
+	}
+	return time.Duration(days * 24 * float64(time.Hour))
+}
+
+// OOMRisks
+// Returns containers which are likely to be OOM killed within horizon, are close to the limit or were recently killed,
+// the riskiest are the first
+func OOMRisks(pods []PodInfo, options OOMOptions, now time.Time) []OOMRisk {
+	var risks []OOMRisk
+	for _, pod := range pods {
+		for _, container := range pod.Containers {
+			recent := !container.OOMKilledAt.IsZero() && now.Sub(container.OOMKilledAt) <= options.Recent
+			nearLimit := container.RAMLimits > 0 && container.WorkingSetPeak >= container.RAMLimits*options.Usage
+			timeToOOM := container.TimeToOOM()
+			if !recent && !nearLimit && (timeToOOM < 0 || timeToOOM >= options.Horizon) {
+				continue
+			}
+			risks = append(risks, OOMRisk{
+				Namespace:   pod.Namespace,
+				Pod:         pod.Name,
+				Container:   container.Name,
+				WorkingSet:  container.WorkingSetPeak,
+				Limit:       container.RAMLimits,
+				Growth:      container.WorkingSetGrowth,
+				TimeToOOM:   timeToOOM,
+				OOMKilledAt: container.OOMKilledAt,
+				Score:       container.OOMRisk(options, now),
+			})
+		}
+	}
+	sort.Sort(OOMRiskByScoreDesc(risks))
+	return risks
+}
+
+// Sorting OOM risks, the riskiest are the first
+func (risks OOMRiskByScoreDesc) Len() int { return len(risks) }
+
+func (risks OOMRiskByScoreDesc) Less(i, j int) bool {
+	return risks[i].Score > risks[j].Score
+}
+
+func (risks OOMRiskByScoreDesc) Swap(i, j int) {
+	risks[i], risks[j] = risks[j], risks[i]
+}
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/yaml"
+	"sort"
+	"strings"
+)
+
+// Patch formats
+const (
+	PatchStrategic = "strategic" // Strategic merge patch per workload
+	PatchKustomize = "kustomize" // Patches and kustomization.yaml per namespace
+	PatchKubectl   = "kubectl"   // kubectl set resources script per namespace
+)
+
+// Workload kinds which can be patched and path to their pod template
+var patchableKinds = map[string][]string{
+	"Deployment":  {"apps/v1", "spec", "template"},
+	"StatefulSet": {"apps/v1", "spec", "template"},
+	"DaemonSet":   {"apps/v1", "spec", "template"},
+	"ReplicaSet":  {"apps/v1", "spec", "template"},
+	"CronJob":     {"batch/v1beta1", "spec", "jobTemplate", "spec", "template"},
+}
+
+// workloadPatch
+// Changed recommendations of one workload
+type workloadPatch struct {
+	dc              string
+	namespace       string
+	kind            string
+	name            string
+	recommendations []Recommendation
+}
+
+// WritePatches
+// Writes patches for changed recommendations to dir/<datacenter>/<namespace>, returns amount of patched workloads
+func (reporter *PodReporter) WritePatches(dir string, formats []string) (int, error) {
+	patches := reporter.workloadPatches()
+	byNamespace := map[string][]workloadPatch{}
+	for _, patch := range patches {
+		path := filepath.Join(dir, patch.dc, patch.namespace)
+		byNamespace[path] = append(byNamespace[path], patch)
+	}
+
+	for path, namespacePatches := range byNamespace {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			return 0, err
+		}
+		for _, format := range formats {
+			var err error
+			switch format {
+			case PatchStrategic:
+				err = writeStrategicPatches(path, namespacePatches)
+			case PatchKustomize:
+				err = writeKustomization(path, namespacePatches)
+			case PatchKubectl:
+				err = writeKubectlScript(path, namespacePatches)
+			default:
+				err = fmt.Errorf("unknown patch format %s", format)
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(patches), nil
+}
+
+// workloadPatches groups changed recommendations by workload, workloads which cannot be patched are skipped
+func (reporter *PodReporter) workloadPatches() []workloadPatch {
+	var patches []workloadPatch
+	index := map[string]int{}
+	for _, dc := range reporter.Datacenters {
+		for _, recommendation := range dc.recommendations {
+			if !recommendation.Changed() {
+				continue
+			}
+			if _, ok := patchableKinds[recommendation.WorkloadKind]; !ok {
+				reporter.logger.Debugf("Skip %s/%s in %s, it cannot be patched", recommendation.WorkloadKind, recommendation.Workload, recommendation.Namespace)
+				continue
+			}
+			key := strings.Join([]string{dc.Name, recommendation.Namespace, recommendation.WorkloadKind, recommendation.Workload}, "/")
+			i, ok := index[key]
+			if !ok {
+				patches = append(patches, workloadPatch{
+					dc:        dc.Name,
+					namespace: recommendation.Namespace,
+					kind:      recommendation.WorkloadKind,
+					name:      recommendation.Workload,
+				})
+				i = len(patches) - 1
+				index[key] = i
+			}
+			patches[i].recommendations = append(patches[i].recommendations, recommendation)
+		}
+	}
+	for i := range patches {
+		sort.SliceStable(patches[i].recommendations, func(a, b int) bool {
+			return patches[i].recommendations[a].Container < patches[i].recommendations[b].Container
+		})
+	}
+	return patches
+}
+
+func (patch *workloadPatch) fileName() string {
+	return fmt.Sprintf("%s-%s.yaml", strings.ToLower(patch.kind), patch.name)
+}
+
+// resources returns requests and limits of recommendation as kubernetes quantities, zero values are omitted
+func resources(recommendation Recommendation) (map[string]string, map[string]string) {
+	requests := map[string]string{}
+	limits := map[string]string{}
+	if recommendation.CPURequests.Recommended > 0 {
+		requests["cpu"] = fmt.Sprintf("%.0fm", recommendation.CPURequests.Recommended)
+	}
+	if recommendation.RAMRequests.Recommended > 0 {
+		requests["memory"] = fmt.Sprintf("%.0fMi", recommendation.RAMRequests.Recommended)
+	}
+	if recommendation.CPULimits.Recommended > 0 {
+		limits["cpu"] = fmt.Sprintf("%.0fm", recommendation.CPULimits.Recommended)
+	}
+	if recommendation.RAMLimits.Recommended > 0 {
+		limits["memory"] = fmt.Sprintf("%.0fMi", recommendation.RAMLimits.Recommended)
+	}
+	return requests, limits
+}
+
+// strategicPatch returns strategic merge patch, which can be used with kubectl patch or kustomize
+func (patch *workloadPatch) strategicPatch() ([]byte, error) {
+	var containers []interface{}
+	for _, recommendation := range patch.recommendations {
+		requests, limits := resources(recommendation)
+		container := map[string]interface{}{
+			"name":      recommendation.Container,
+			"resources": map[string]interface{}{"requests": requests},
+		}
+		if len(limits) > 0 {
+			container["resources"].(map[string]interface{})["limits"] = limits
+		}
+		containers = append(containers, container)
+	}
+
+	path := patchableKinds[patch.kind]
+	var template interface{} = map[string]interface{}{
+		"spec": map[string]interface{}{"containers": containers},
+	}
+	for i := len(path) - 1; i > 0; i-- {
+		template = map[string]interface{}{path[i]: template}
+	}
+	object := template.(map[string]interface{})
+	object["apiVersion"] = path[0]
+	object["kind"] = patch.kind
+	object["metadata"] = map[string]interface{}{
+		"name":      patch.name,
+		"namespace": patch.namespace,
+	}
+	return yaml.Marshal(object)
+}
+
+func writeStrategicPatches(path string, patches []workloadPatch) error {
+	for _, patch := range patches {
+		data, err := patch.strategicPatch()
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(path, patch.fileName()), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeKustomization writes patches and kustomization.yaml, which applies them
+func writeKustomization(path string, patches []workloadPatch) error {
+	if err := writeStrategicPatches(path, patches); err != nil {
+		return err
+	}
+	var files []string
+	for _, patch := range patches {
+		files = append(files, patch.fileName())
+	}
+	sort.Strings(files)
+	data, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion":            "kustomize.config.k8s.io/v1beta1",
+		"kind":                  "Kustomization",
+		"patchesStrategicMerge": files,
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(path, "kustomization.yaml"), data, 0o644)
+}
+
+// writeKubectlScript writes shell script with kubectl set resources commands
+func writeKubectlScript(path string, patches []workloadPatch) error {
+	script := "#!/bin/sh\n# Generated by podreporter, review before applying\nset -e\n\n"
+	for _, patch := range patches {
+		for _, recommendation := range patch.recommendations {
+			requests, limits := resources(recommendation)
+			script += fmt.Sprintf("kubectl --context %s -n %s set resources %s/%s -c %s --requests=%s",
+				patch.dc,
+				patch.namespace,
+				strings.ToLower(patch.kind),
+				patch.name,
+				recommendation.Container,
+				joinQuantities(requests))
+			if len(limits) > 0 {
+				script += " --limits=" + joinQuantities(limits)
+			}
+			script += "\n"
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(path, "set-resources.sh"), []byte(script), 0o755)
+}
+
+// joinQuantities formats resources like cpu=100m,memory=64Mi
+func joinQuantities(quantities map[string]string) string {
+	var parts []string
+	for name, value := range quantities {
+		parts = append(parts, name+"="+value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
@@ -1,19 +1,74 @@
 package cmd
 
+import (
+	"math"
+	"time"
+)
+
 type PodInfo struct {
 	Name        string
 	Namespace   string
 	Cluster     string
 	Application string
 	Uid         string
+
+	Workload     string // Controller name, deployments are resolved from replica sets
+	WorkloadKind string
+	Team         string
+	NodeLabels   map[string]string
+	QOSClass     string // Guaranteed, Burstable or BestEffort
+	Phase        string // Pending, Running, Succeeded, Failed or Unknown
+	CreatedAt    time.Time
+
+	Labels          map[string]string
+	NamespaceLabels map[string]string
+	PolicyFindings  []PolicyFinding
+	Suppressions    []Suppression   // From annotations of pod, workload and namespace, including expired ones
+	Ignored         map[string]bool // Findings suppressed by active suppressions
+
 	CPUMetric   float64
 	RAMMetric   float64
 	CPULimits   float64
 	RAMLimits   float64
 	CPURequsts  float64
 	RAMRequests float64
-	RatingCPU   int
-	RatingRAM   int
+	CPUScore    ResourceScore
+	RAMScore    ResourceScore
+	Processed   bool // Metrics were received from prometheus
+	Cost        PodCost
+
+	CPUThrottling float64 // Throttled periods ratio of the most throttled container
+	RAMWorkingSet float64 // Peak working set, Mi
+	CPUAverage    float64 // Average usage, millicores. Peak is used for sizing, average for cost
+	RAMAverage    float64 // Average usage, Mi
+	NetRxRate     float64 // Average network receive, bytes per second
+	NetTxRate     float64 // Average network transmit, bytes per second
+	FsReadRate    float64 // Average filesystem reads, bytes per second
+	FsWriteRate   float64 // Average filesystem writes, bytes per second
+
+	CPUQuantiles map[string]float64 // Usage quantiles by phi, millicores. Filled by VictoriaMetrics only
+	RAMQuantiles map[string]float64 // Usage quantiles by phi, Mi. Filled by VictoriaMetrics only
+
+	Containers []ContainerInfo
+}
+
+// ContainerInfo
+// Resources of a single container, same units as in PodInfo
+type ContainerInfo struct {
+	Name        string
+	CPUMetric   float64
+	RAMMetric   float64
+	CPULimits   float64
+	RAMLimits   float64
+	CPURequsts  float64
+	RAMRequests float64
+	Processed   bool // Metrics were received for container
+
+	WorkingSetPeak   float64 // Peak working set, Mi
+	WorkingSetGrowth float64 // Trend of working set, Mi per day
+	WorkingSetTrend  float64 // Trend value at evaluation time, Mi
+	Restarts         int32
+	OOMKilledAt      time.Time // Last OOM kill, zero if there were none
 }
 
 type PodByLimitCPU []PodInfo
@@ -36,37 +91,86 @@ type PodByRequestsRAM []PodInfo
 
 type PodByRequestsRAMDesc []PodInfo
 
-type PodByRatingCPU []PodInfo
+type PodByEfficiencyCPU []PodInfo
+
+type PodByEfficiencyRAM []PodInfo
+
+type PodByEfficiencyCPUDesc []PodInfo
+
+type PodByThrottlingDesc []PodInfo
 
-type PodByRatingRAM []PodInfo
+type PodByLimitUsageRAMDesc []PodInfo
 
-type PodByRatingCPUDesc []PodInfo
+type PodByNetworkDesc []PodInfo
 
-type PodByRatingRAMDesc []PodInfo
+type PodByDiskDesc []PodInfo
 
-// SetRequestsRating
-// Set pod rating from compare requests
-func (pod *PodInfo) SetRequestsRating() {
-	pod.RatingCPU = 100
+type PodByEfficiencyRAMDesc []PodInfo
 
-	if pod.CPURequsts == 0 {
-		pod.RatingCPU = 999
-		return
+type PodByLimitRequestRatioDesc []PodInfo
+
+// SetScores
+// Scores CPU and RAM usage against requests and limits
+func (pod *PodInfo) SetScores(options ScoringOptions) {
+	pod.CPUScore = ScoreResource(pod.CPUMetric, pod.CPURequsts, pod.CPULimits, options)
+	pod.RAMScore = ScoreResource(pod.RAMMetric, pod.RAMRequests, pod.RAMLimits, options)
+}
+
+// Score returns score of resource, "CPU" or "RAM"
+func (pod *PodInfo) Score(resource string) ResourceScore {
+	if resource == "RAM" {
+		return pod.RAMScore
 	}
-	if pod.CPURequsts < 2*pod.CPUMetric {
-		pod.RatingCPU = 5
-		return
+	return pod.CPUScore
+}
+
+func (container *ContainerInfo) UpdateMetrics(CPU float64, RAM float64) {
+	container.CPUMetric = CPU * 1000
+	container.RAMMetric = RAM / 1024 / 1024
+	container.Processed = true
+}
+
+func (pod *PodInfo) SetCPUQuantile(phi string, CPU float64) {
+	if pod.CPUQuantiles == nil {
+		pod.CPUQuantiles = map[string]float64{}
 	}
+	pod.CPUQuantiles[phi] = CPU * 1000
+}
 
-	if pod.CPURequsts > 3*pod.CPUMetric {
-		pod.RatingCPU = 5
+func (pod *PodInfo) SetRAMQuantile(phi string, RAM float64) {
+	if pod.RAMQuantiles == nil {
+		pod.RAMQuantiles = map[string]float64{}
 	}
+	pod.RAMQuantiles[phi] = RAM / 1024 / 1024
+}
 
+// RAMHeadroom
+// Part of memory limit which is not used by working set, 1 if limits are not set
+func (pod *PodInfo) RAMHeadroom() float64 {
+	if pod.RAMLimits == 0 {
+		return 1
+	}
+	return 1 - pod.RAMWorkingSet/pod.RAMLimits
+}
+
+// CPULimitRequestRatio returns limits to requests ratio, 0 if requests or limits are not set
+func (pod *PodInfo) CPULimitRequestRatio() float64 {
+	return ratio(pod.CPULimits, pod.CPURequsts)
+}
+
+func (pod *PodInfo) RAMLimitRequestRatio() float64 {
+	return ratio(pod.RAMLimits, pod.RAMRequests)
+}
+
+// LimitRequestRatio returns the biggest limits to requests ratio of CPU and RAM
+func (pod *PodInfo) LimitRequestRatio() float64 {
+	return math.Max(pod.CPULimitRequestRatio(), pod.RAMLimitRequestRatio())
 }
 
 func (pod *PodInfo) UpdateMetrics(CPU float64, RAM float64) {
 	pod.CPUMetric = CPU * 1000
 	pod.RAMMetric = RAM / 1024 / 1024
+	pod.Processed = true
 }
 
 // Sorting pods, Limits CPU
@@ -159,46 +263,101 @@ func (pods PodByMetricRAMDesc) Swap(i, j int) {
 	pods[i], pods[j] = pods[j], pods[i]
 }
 
-// Sorting pods, Limits RAM
-func (pods PodByRatingRAM) Len() int { return len(pods) }
+// Sorting pods, RAM efficiency
+func (pods PodByEfficiencyRAM) Len() int { return len(pods) }
 
-func (pods PodByRatingRAM) Less(i, j int) bool {
-	return pods[i].RatingRAM < pods[j].RatingRAM
+func (pods PodByEfficiencyRAM) Less(i, j int) bool {
+	return pods[i].RAMScore.Efficiency < pods[j].RAMScore.Efficiency
 }
 
-func (pods PodByRatingRAM) Swap(i, j int) {
+func (pods PodByEfficiencyRAM) Swap(i, j int) {
 	pods[i], pods[j] = pods[j], pods[i]
 }
 
-// Sorting pods, Limits RAM DESC
-func (pods PodByRatingRAMDesc) Len() int { return len(pods) }
+// Sorting pods, RAM efficiency Desc
+func (pods PodByEfficiencyRAMDesc) Len() int { return len(pods) }
 
-func (pods PodByRatingRAMDesc) Less(i, j int) bool {
-	return pods[i].RatingRAM > pods[j].RatingRAM
+func (pods PodByEfficiencyRAMDesc) Less(i, j int) bool {
+	return pods[i].RAMScore.Efficiency > pods[j].RAMScore.Efficiency
 }
 
-func (pods PodByRatingRAMDesc) Swap(i, j int) {
+func (pods PodByEfficiencyRAMDesc) Swap(i, j int) {
 	pods[i], pods[j] = pods[j], pods[i]
 }
 
-// Sorting pods, Metric CPU
-func (pods PodByRatingCPU) Len() int { return len(pods) }
+// Sorting pods, CPU efficiency
+func (pods PodByEfficiencyCPU) Len() int { return len(pods) }
 
-func (pods PodByRatingCPU) Less(i, j int) bool {
-	return pods[i].RatingCPU < pods[j].RatingCPU
+func (pods PodByEfficiencyCPU) Less(i, j int) bool {
+	return pods[i].CPUScore.Efficiency < pods[j].CPUScore.Efficiency
 }
 
-func (pods PodByRatingCPU) Swap(i, j int) {
+func (pods PodByEfficiencyCPU) Swap(i, j int) {
 	pods[i], pods[j] = pods[j], pods[i]
 }
 
-// Sorting pods, Metric CPU Desc
-func (pods PodByRatingCPUDesc) Len() int { return len(pods) }
+// Sorting pods, CPU efficiency Desc
+func (pods PodByEfficiencyCPUDesc) Len() int { return len(pods) }
+
+func (pods PodByEfficiencyCPUDesc) Less(i, j int) bool {
+	return pods[i].CPUScore.Efficiency > pods[j].CPUScore.Efficiency
+}
+
+func (pods PodByEfficiencyCPUDesc) Swap(i, j int) {
+	pods[i], pods[j] = pods[j], pods[i]
+}
+
+// Sorting pods, CPU throttling Desc
+func (pods PodByThrottlingDesc) Len() int { return len(pods) }
+
+func (pods PodByThrottlingDesc) Less(i, j int) bool {
+	return pods[i].CPUThrottling > pods[j].CPUThrottling
+}
+
+func (pods PodByThrottlingDesc) Swap(i, j int) {
+	pods[i], pods[j] = pods[j], pods[i]
+}
+
+// Sorting pods, working set to RAM limit ratio Desc, pods without limits are the last
+func (pods PodByLimitUsageRAMDesc) Len() int { return len(pods) }
+
+func (pods PodByLimitUsageRAMDesc) Less(i, j int) bool {
+	return pods[i].RAMHeadroom() < pods[j].RAMHeadroom()
+}
+
+func (pods PodByLimitUsageRAMDesc) Swap(i, j int) {
+	pods[i], pods[j] = pods[j], pods[i]
+}
+
+// Sorting pods, network traffic Desc
+func (pods PodByNetworkDesc) Len() int { return len(pods) }
+
+func (pods PodByNetworkDesc) Less(i, j int) bool {
+	return pods[i].NetRxRate+pods[i].NetTxRate > pods[j].NetRxRate+pods[j].NetTxRate
+}
+
+func (pods PodByNetworkDesc) Swap(i, j int) {
+	pods[i], pods[j] = pods[j], pods[i]
+}
+
+// Sorting pods, disk IO Desc
+func (pods PodByDiskDesc) Len() int { return len(pods) }
+
+func (pods PodByDiskDesc) Less(i, j int) bool {
+	return pods[i].FsReadRate+pods[i].FsWriteRate > pods[j].FsReadRate+pods[j].FsWriteRate
+}
+
+func (pods PodByDiskDesc) Swap(i, j int) {
+	pods[i], pods[j] = pods[j], pods[i]
+}
+
+// Sorting pods, the biggest limits to requests ratio Desc
+func (pods PodByLimitRequestRatioDesc) Len() int { return len(pods) }
 
-func (pods PodByRatingCPUDesc) Less(i, j int) bool {
-	return pods[i].RatingCPU > pods[j].RatingCPU
+func (pods PodByLimitRequestRatioDesc) Less(i, j int) bool {
+	return pods[i].LimitRequestRatio() > pods[j].LimitRequestRatio()
 }
 
-func (pods PodByRatingCPUDesc) Swap(i, j int) {
+func (pods PodByLimitRequestRatioDesc) Swap(i, j int) {
 	pods[i], pods[j] = pods[j], pods[i]
 }
@@ -1,28 +1,40 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
-	"github.com/slack-go/slack"
-	"sort"
-	"strconv"
-	"strings"
+	"path"
 	"sync"
 	"time"
 )
 
 type PodReporter struct {
-	Datacenters    []Datacenter
-	prom           *Prometheus
-	slackClient    *slack.Client
-	logger         *log.Entry
-	maxConcurrency int
+	Datacenters      []Datacenter
+	source           MetricsSource
+	logger           *log.Entry
+	maxConcurrency   int
+	progressInterval time.Duration
+	scoring          ScoringOptions
+	recommend        RecommendOptions
+	policy           *Policy
+	bestEffortDenied []string
+	oom              OOMOptions
+	idle             IdleOptions
+	pricing          *Pricing
+	teamLabel        string
+	processed        int
+	total            int
 }
 
 type Datacenter struct {
-	Name       string
-	KubeConfig []byte
-	pods       []PodInfo
+	Name            string
+	KubeConfig      []byte
+	pods            []PodInfo
+	recommendations []Recommendation
+	allocatableCPU  float64
+	allocatableRAM  float64
 }
 
 type task struct {
@@ -30,236 +42,244 @@ type task struct {
 	dc  string
 }
 
-func CreateReporter(datacenters []Datacenter, prom *Prometheus, slackClient *slack.Client, logger *log.Entry, maxConcurrency int) *PodReporter {
+func CreateReporter(datacenters []Datacenter, source MetricsSource, logger *log.Entry, maxConcurrency int, progressInterval time.Duration) *PodReporter {
 	reporter := PodReporter{
-		Datacenters:    datacenters,
-		prom:           prom,
-		slackClient:    slackClient,
-		logger:         logger,
-		maxConcurrency: maxConcurrency,
+		Datacenters:      datacenters,
+		source:           source,
+		logger:           logger,
+		maxConcurrency:   maxConcurrency,
+		progressInterval: progressInterval,
+		scoring:          DefaultScoringOptions(),
+		recommend:        DefaultRecommendOptions(),
+		teamLabel:        "team",
+		oom:              DefaultOOMOptions(),
+		idle:             DefaultIdleOptions(),
 	}
 	return &reporter
 }
 
-func (reporter *PodReporter) FillKubePods(namespaceSelector []string) error {
+func (reporter *PodReporter) SetScoringOptions(options ScoringOptions) {
+	reporter.scoring = options
+}
+
+func (reporter *PodReporter) SetRecommendOptions(options RecommendOptions) {
+	reporter.recommend = options
+}
+
+// SetPolicy
+// Enables policy rules evaluation for pods with metrics
+func (reporter *PodReporter) SetPolicy(policy *Policy) {
+	reporter.policy = policy
+}
+
+func (reporter *PodReporter) SetOOMOptions(options OOMOptions) {
+	reporter.oom = options
+}
+
+func (reporter *PodReporter) SetIdleOptions(options IdleOptions) {
+	reporter.idle = options
+}
+
+// SetBestEffortDenied
+// Sets namespace patterns, where BestEffort pods are reported
+func (reporter *PodReporter) SetBestEffortDenied(patterns []string) {
+	reporter.bestEffortDenied = patterns
+}
+
+// SetPricing
+// Enables cost estimation of pods
+func (reporter *PodReporter) SetPricing(pricing *Pricing) {
+	reporter.pricing = pricing
+}
+
+// SetTeamLabel
+// Sets pod or namespace label with team name
+func (reporter *PodReporter) SetTeamLabel(label string) {
+	reporter.teamLabel = label
+}
+
+// FillKubePods
+// Lists pods of every datacenter. On error datacenters which were already listed keep their pods
+func (reporter *PodReporter) FillKubePods(ctx context.Context, namespaceSelector []string) error {
 	var tempPods []PodInfo
-	cluster := KubeCluster{}
 	for i, dc := range reporter.Datacenters {
+		// Cluster is created per datacenter, so allocatable of one cluster is never reported for another
+		cluster := KubeCluster{}
 		err := cluster.AuthRemote(dc.KubeConfig)
 		if err != nil {
 			return err
 		}
-		tempPods, err = cluster.ReturnPods(namespaceSelector, reporter.logger)
+		tempPods, err = cluster.ReturnPods(ctx, namespaceSelector, reporter.logger)
 		reporter.Datacenters[i].pods = tempPods
 		if err != nil {
 			return err
 		}
+		reporter.Datacenters[i].allocatableCPU = cluster.AllocatableCPU
+		reporter.Datacenters[i].allocatableRAM = cluster.AllocatableRAM
+		for j := range reporter.Datacenters[i].pods {
+			reporter.Datacenters[i].pods[j].Team = podTeam(&reporter.Datacenters[i].pods[j], reporter.teamLabel)
+		}
 	}
 	return nil
 }
 
-func (reporter *PodReporter) worker(wg *sync.WaitGroup, T chan *task, R chan error, id int) {
-	var cpu float64
-	var ram float64
-
-	for taskItem := range T {
-		cpu = 0.0
-		ram = 0.0
-
-		dc := taskItem.dc
+func (reporter *PodReporter) processTask(ctx context.Context, taskItem *task, id int) error {
+	reporter.logger.Debugf("ThreadID %d - Start query metrics for DC %v and pod %v", id, taskItem.dc, taskItem.pod.Name)
+	usage, err := reporter.source.PodUsage(ctx, taskItem.dc, taskItem.pod)
+	if err != nil {
+		return err
+	}
+	usage.Apply(taskItem.pod)
+	taskItem.pod.SetScores(reporter.scoring)
+	if reporter.policy != nil {
+		taskItem.pod.PolicyFindings = reporter.policy.Evaluate(taskItem.pod)
+	}
+	taskItem.pod.ApplySuppressions(time.Now())
+	if reporter.pricing != nil {
+		taskItem.pod.Cost = reporter.pricing.PodCost(taskItem.dc, taskItem.pod)
+	}
+	reporter.logger.Debugf("Thread id %d - usage is %+v", id, *usage)
+	return nil
+}
 
-		reporter.logger.Debugf("ThreadID %d - Start query prom for DC %v and pod %v", id, dc, taskItem.pod.Name)
-		contCPUQuery := fmt.Sprintf("max_over_time(sum(rate(container_cpu_usage_seconds_total{datacenter=\"%s\",namespace=\"%s\", pod=\"%s\", id=~\".*%s.*\"}))[7d:1m])",
-			dc,
-			taskItem.pod.Namespace,
-			taskItem.pod.Name,
-			taskItem.pod.Uid)
-		contRAMQuery := fmt.Sprintf("max_over_time(sum(container_memory_rss{namespace=\"%s\",pod=\"%s\", id=~\".*%s.*\"})[7d:1m])",
-			taskItem.pod.Namespace,
-			taskItem.pod.Name,
-			taskItem.pod.Uid)
-		resultCPU, err := reporter.prom.InstanceQuery(contCPUQuery)
-		if err != nil {
-			reporter.logger.Debugf("Thread %d got an error %v", id, err)
-			R <- err
-			wg.Done()
-			return
+// worker
+// Processes tasks until channel is closed, after the first error it cancels context and skips the rest
+func (reporter *PodReporter) worker(ctx context.Context, cancel context.CancelFunc, tasks <-chan *task, errs *errorCollector, progress *Progress, id int) {
+	for taskItem := range tasks {
+		if ctx.Err() != nil {
+			continue
+		}
+		err := reporter.processTask(ctx, taskItem, id)
+		if errors.Is(err, ErrNoMetrics) {
+			// Pod is left unprocessed and counted in partial report
+			reporter.logger.Debugf("Thread %d - no metrics for pod %s/%s in dc %s", id, taskItem.pod.Namespace, taskItem.pod.Name, taskItem.dc)
+			progress.Failed()
+			continue
 		}
-		resultRAM, err := reporter.prom.InstanceQuery(contRAMQuery)
 		if err != nil {
 			reporter.logger.Debugf("Thread %d got an error %v", id, err)
-			R <- err
-			wg.Done()
-			return
+			if ctx.Err() != nil {
+				// Cancelled by someone else, error is not the reason
+				progress.Failed()
+				continue
+			}
+			errs.Add(fmt.Errorf("pod %s/%s in dc %s: %w", taskItem.pod.Namespace, taskItem.pod.Name, taskItem.dc, err))
+			progress.Failed()
+			cancel()
+			continue
 		}
-		stringCPU := (*resultCPU).(string)
-		stringRAM := (*resultRAM).(string)
-		cpu, _ = strconv.ParseFloat(stringCPU, 64)
-		ram, _ = strconv.ParseFloat(stringRAM, 64)
-		//taskItem.pod.CPUMetric += cpu * 1000
-		//taskItem.pod.RAMMetric += ram / 1024 / 1024
-		taskItem.pod.UpdateMetrics(cpu, ram)
-		taskItem.pod.SetRequestsRating()
-		reporter.logger.Debugf("Thread id %d - PROM CPU is %f", id, cpu)
-		reporter.logger.Debugf("Thread id %d - PROM RAM is %f", id, ram)
+		progress.Done()
 	}
-	wg.Done()
-	return
 }
 
-func (reporter *PodReporter) FillPrometheusInfo() error {
+// FillPrometheusInfo
+// Queries metrics for all pods. If parent context is cancelled, pods which were processed keep their metrics,
+// so partial report still can be generated
+func (reporter *PodReporter) FillPrometheusInfo(parent context.Context) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
 
 	tasksChannel := make(chan *task)
-	errChannel := make(chan error)
-	var err error = nil
+	errs := &errorCollector{}
 	var wg sync.WaitGroup
-	var counter = 0
+	var total = 0
+
+	for _, dc := range reporter.Datacenters {
+		total += len(dc.pods)
+	}
+	progress := CreateProgress(total, reporter.progressInterval, reporter.logger)
+	go progress.Report(ctx)
 
 	for i := 0; i < reporter.maxConcurrency; i++ {
 		wg.Add(1)
-		go reporter.worker(&wg, tasksChannel, errChannel, i)
+		go func(id int) {
+			defer wg.Done()
+			reporter.worker(ctx, cancel, tasksChannel, errs, progress, id)
+		}(i)
 	}
 
 	reporter.logger.Debugf("Generated %d workers", reporter.maxConcurrency)
 
 	start := time.Now()
-	reporter.logger.Info("Starting processing pods...")
-	go func() {
-		for i, dc := range reporter.Datacenters {
-			for j, pod := range dc.pods {
-				newTask := task{&reporter.Datacenters[i].pods[j], dc.Name}
-				select {
-				case err = <-errChannel:
-					close(tasksChannel)
-					return
-				case tasksChannel <- &newTask:
-					reporter.logger.Debugf("Processing pod %v in dc %v", pod.Name, dc.Name)
-				}
-				counter++
+	reporter.logger.Infof("Starting processing %d pods...", total)
+
+dispatch:
+	for i, dc := range reporter.Datacenters {
+		for j, pod := range dc.pods {
+			select {
+			case <-ctx.Done():
+				break dispatch
+			case tasksChannel <- &task{&reporter.Datacenters[i].pods[j], dc.Name}:
+				reporter.logger.Debugf("Processing pod %v in dc %v", pod.Name, dc.Name)
 			}
 		}
-		reporter.logger.Debugf("All tasks have been sending. Waiting until threads will be closing")
-		close(tasksChannel)
-	}()
+	}
+	reporter.logger.Debugf("All tasks have been sending. Waiting until threads will be closing")
+	close(tasksChannel)
 
 	wg.Wait()
 	elapsed := time.Since(start)
-	reporter.logger.Infof("Processed %d pods for the %s", counter, elapsed)
+	reporter.logger.Infof("Processed %d of %d pods for the %s", progress.Processed(), total, elapsed)
+	reporter.processed = progress.Processed()
+	reporter.total = total
+
+	// Rules which do not use usage are checked for pods without metrics too
+	if reporter.policy != nil {
+		now := time.Now()
+		for i := range reporter.Datacenters {
+			for j := range reporter.Datacenters[i].pods {
+				pod := &reporter.Datacenters[i].pods[j]
+				if !pod.Processed {
+					pod.PolicyFindings = reporter.policy.Evaluate(pod)
+					pod.ApplySuppressions(now)
+				}
+			}
+		}
+	}
 
-	return err
+	if err := parent.Err(); err != nil {
+		errs.Add(err)
+	}
+	return errs.ErrorOrNil()
 }
 
-func (reporter *PodReporter) GetReport(slackChannel string) {
-
-	var podsOutput = 5
-
-	reporter.logger.Info("Generating report")
-	blocks := []slack.Block{
-		slack.NewHeaderBlock(&slack.TextBlockObject{
-			Type: "plain_text",
-			Text: ":newspaper: Daily kubernetes resources news :newspaper:"}),
+// FillRecommendations
+// Calculates right-sizing recommendations for workloads, must be called after FillPrometheusInfo
+func (reporter *PodReporter) FillRecommendations() {
+	for i, dc := range reporter.Datacenters {
+		reporter.Datacenters[i].recommendations = Recommend(dc.Name, dc.pods, reporter.recommend)
+		reporter.logger.Debugf("Calculated %d recommendations for dc %s", len(reporter.Datacenters[i].recommendations), dc.Name)
 	}
+}
 
-	curTime := time.Now()
-	curTimeLine := fmt.Sprintf("*%s* | Dops team", curTime.Format("01-02-2006"))
-
-	blocks = append(blocks, slack.NewContextBlock("HeadLine", slack.MixedElement(slack.TextBlockObject{
-		Type: "mrkdwn",
-		Text: curTimeLine,
-	})))
-	blocks = append(blocks, slack.NewDividerBlock())
-
-	for _, dc := range reporter.Datacenters {
-
-		if podsOutput > len(dc.pods) {
-			podsOutput = len(dc.pods)
-		}
-
-		dcString := fmt.Sprintf(":office: *Datacenter:* %s", strings.ToUpper(dc.Name))
-		blocks = append(blocks, slack.NewSectionBlock(
-			&slack.TextBlockObject{
-				Type: slack.MarkdownType,
-				Text: dcString,
-			}, nil, nil))
-
-		// Sort by CPU
-		sort.Sort(PodByMetricCPUDesc(dc.pods))
-		blocks = append(blocks, slack.NewSectionBlock(
-			&slack.TextBlockObject{
-				Type: slack.MarkdownType,
-				Text: fmt.Sprintf("*Top %d pods by CPU*", podsOutput),
-			}, nil, nil))
-
-		podString := ""
-
-		for i := 0; i < podsOutput; i++ {
-			podString += fmt.Sprintf("*Ns:* %s\t*Pod:* %s\t*CPU:* %.1fm\t *Limits:* %.1fm\n",
-				dc.pods[i].Namespace,
-				dc.pods[i].Name,
-				dc.pods[i].CPUMetric,
-				dc.pods[i].CPULimits)
-		}
-		blocks = append(blocks, slack.NewContextBlock(dc.Name+"-CPU", slack.MixedElement(slack.TextBlockObject{
-			Type: "mrkdwn",
-			Text: podString,
-		})))
-
-		// Sort By RAM
-		sort.Sort(PodByMetricRAMDesc(dc.pods))
-		blocks = append(blocks, slack.NewSectionBlock(
-			&slack.TextBlockObject{
-				Type: slack.MarkdownType,
-				Text: fmt.Sprintf("*Top %d pods by RAM*", podsOutput),
-			}, nil, nil))
-
-		podString = ""
-
-		for i := 0; i < podsOutput; i++ {
-			podString += fmt.Sprintf("*Ns:* %s\t*Pod:* %s\t*RAM:* %.1fMi\t *Limits:* %.1fMi\n",
-				dc.pods[i].Namespace,
-				dc.pods[i].Name,
-				dc.pods[i].RAMMetric,
-				dc.pods[i].RAMLimits)
+// processedPods returns pods which have metrics
+func processedPods(pods []PodInfo) []PodInfo {
+	var result []PodInfo
+	for _, pod := range pods {
+		if pod.Processed {
+			result = append(result, pod)
 		}
-		blocks = append(blocks, slack.NewContextBlock(dc.Name+"-RAM", slack.MixedElement(slack.TextBlockObject{
-			Type: "mrkdwn",
-			Text: podString,
-		})))
-
-		// Sort by CPU rating
-		sort.Sort(PodByRatingCPU(dc.pods))
-		blocks = append(blocks, slack.NewSectionBlock(
-			&slack.TextBlockObject{
-				Type: slack.MarkdownType,
-				Text: fmt.Sprintf("*Top %d pods with possible wrong CPU requests*", podsOutput),
-			}, nil, nil))
-
-		podString = ""
+	}
+	return result
+}
 
-		for i := 0; i < podsOutput; i++ {
-			if dc.pods[i].RatingCPU > 5 {
-				continue
-			}
-			podString += fmt.Sprintf("*Ns:* %s\t*Pod:* %s\t*CPU:* %.1fm\t *Requests:* %.1fm\n",
-				dc.pods[i].Namespace,
-				dc.pods[i].Name,
-				dc.pods[i].RAMMetric,
-				dc.pods[i].CPURequsts)
+// matchNamespace returns true, if namespace matches any of shell patterns
+func matchNamespace(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return true
 		}
-		blocks = append(blocks, slack.NewContextBlock(dc.Name+"R-RAM", slack.MixedElement(slack.TextBlockObject{
-			Type: "mrkdwn",
-			Text: podString,
-		})))
-		blocks = append(blocks, slack.NewDividerBlock())
 	}
+	return false
+}
 
-	_, _, _, err := reporter.slackClient.SendMessage(
-		slackChannel,
-		slack.MsgOptionBlocks(blocks...),
-		slack.MsgOptionAsUser(true), // Add this if you want that the bot would post message as a user, otherwise it will send response using the default slackbot
-	)
-	if err != nil {
-		fmt.Printf("%s\n", err)
-		return
+// filterPods returns pods which match the filter
+func filterPods(pods []PodInfo, filter func(pod PodInfo) bool) []PodInfo {
+	var result []PodInfo
+	for _, pod := range pods {
+		if filter(pod) {
+			result = append(result, pod)
+		}
 	}
+	return result
 }
@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sigs.k8s.io/yaml"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Severities of policy rules, ordered from the least important
+var severities = []string{"info", "warning", "critical"}
+
+// Policy
+// Declarative rules loaded from YAML file, every rule is evaluated for every pod in its scope
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule
+// Pod violates rule, when all conditions are true
+type Rule struct {
+	Name     string   `json:"name"`
+	Severity string   `json:"severity"`
+	Message  string   `json:"message"`
+	Scope    Scope    `json:"scope"`
+	When     []string `json:"when"`
+
+	conditions []condition
+	usage      bool // Conditions use usage, so rule is evaluated only for pods with metrics
+}
+
+// Scope
+// Empty fields match everything
+type Scope struct {
+	Namespaces        []string          `json:"namespaces"`
+	NamespaceSelector map[string]string `json:"namespaceSelector"`
+	PodSelector       map[string]string `json:"podSelector"`
+	WorkloadKinds     []string          `json:"workloadKinds"`
+	QOSClasses        []string          `json:"qosClasses"` // Guaranteed, Burstable or BestEffort
+}
+
+// condition
+// Comparison like "cpu.request_usage_ratio > 4" or "cpu.limits != cpu.requests"
+type condition struct {
+	left  string
+	op    string
+	right string
+}
+
+// PolicyFinding
+// Violation of a rule by a pod
+type PolicyFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+var conditionOperators = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// podFields
+// Values of pod which can be used in conditions
+var podFields = map[string]func(pod *PodInfo) float64{
+	"cpu.usage":                  func(pod *PodInfo) float64 { return pod.CPUMetric },
+	"cpu.requests":               func(pod *PodInfo) float64 { return pod.CPURequsts },
+	"cpu.limits":                 func(pod *PodInfo) float64 { return pod.CPULimits },
+	"cpu.efficiency":             func(pod *PodInfo) float64 { return pod.CPUScore.Efficiency },
+	"cpu.request_usage_ratio":    func(pod *PodInfo) float64 { return requestUsageRatio(pod.CPURequsts, pod.CPUMetric) },
+	"cpu.limit_request_ratio":    func(pod *PodInfo) float64 { return pod.CPULimitRequestRatio() },
+	"cpu.throttling":             func(pod *PodInfo) float64 { return pod.CPUThrottling },
+	"memory.usage":               func(pod *PodInfo) float64 { return pod.RAMMetric },
+	"memory.working_set":         func(pod *PodInfo) float64 { return pod.RAMWorkingSet },
+	"memory.requests":            func(pod *PodInfo) float64 { return pod.RAMRequests },
+	"memory.limits":              func(pod *PodInfo) float64 { return pod.RAMLimits },
+	"memory.efficiency":          func(pod *PodInfo) float64 { return pod.RAMScore.Efficiency },
+	"memory.request_usage_ratio": func(pod *PodInfo) float64 { return requestUsageRatio(pod.RAMRequests, pod.RAMMetric) },
+	"memory.limit_request_ratio": func(pod *PodInfo) float64 { return pod.RAMLimitRequestRatio() },
+	"memory.headroom":            func(pod *PodInfo) float64 { return pod.RAMHeadroom() },
+}
+
+// Fields which are taken from pod spec, rules with only these fields are evaluated for pods without metrics too
+var specFields = map[string]bool{
+	"cpu.requests":               true,
+	"cpu.limits":                 true,
+	"cpu.limit_request_ratio":    true,
+	"memory.requests":            true,
+	"memory.limits":              true,
+	"memory.limit_request_ratio": true,
+}
+
+// ratio returns 0 if divider is 0
+func ratio(value float64, divider float64) float64 {
+	if divider == 0 {
+		return 0
+	}
+	return value / divider
+}
+
+// requestUsageRatio returns +Inf for requests without any usage, so the most wasteful pods match "> N" rules,
+// and 0 if there are neither requests nor usage
+func requestUsageRatio(requests float64, usage float64) float64 {
+	if usage == 0 && requests > 0 {
+		return math.Inf(1)
+	}
+	return ratio(requests, usage)
+}
+
+// LoadPolicy
+// Reads and validates policy file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := Policy{}
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, err
+	}
+	for i := range policy.Rules {
+		if err := policy.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", policy.Rules[i].Name, err)
+		}
+	}
+	return &policy, nil
+}
+
+func (rule *Rule) compile() error {
+	if rule.Name == "" {
+		return errors.New("rule name is not provided")
+	}
+	if rule.Severity == "" {
+		rule.Severity = "warning"
+	}
+	if severityLevel(rule.Severity) < 0 {
+		return fmt.Errorf("unknown severity %s", rule.Severity)
+	}
+	if len(rule.When) == 0 {
+		return errors.New("rule has no conditions")
+	}
+	rule.conditions = nil
+	rule.usage = false
+	for _, expression := range rule.When {
+		parsed, err := parseCondition(expression)
+		if err != nil {
+			return err
+		}
+		rule.conditions = append(rule.conditions, parsed)
+		rule.usage = rule.usage || parsed.usage()
+	}
+	return nil
+}
+
+func parseCondition(expression string) (condition, error) {
+	for _, op := range conditionOperators {
+		parts := strings.SplitN(expression, op, 2)
+		if len(parts) != 2 {
+			continue
+		}
+		parsed := condition{
+			left:  strings.TrimSpace(parts[0]),
+			op:    op,
+			right: strings.TrimSpace(parts[1]),
+		}
+		for _, operand := range []string{parsed.left, parsed.right} {
+			if _, ok := podFields[operand]; ok {
+				continue
+			}
+			if _, err := strconv.ParseFloat(operand, 64); err != nil {
+				return condition{}, fmt.Errorf("unknown field %q in %q", operand, expression)
+			}
+		}
+		return parsed, nil
+	}
+	return condition{}, fmt.Errorf("cannot find comparison in %q", expression)
+}
+
+// usage returns true, if condition uses fields which depend on metrics
+func (cond condition) usage() bool {
+	for _, operand := range []string{cond.left, cond.right} {
+		if _, ok := podFields[operand]; ok && !specFields[operand] {
+			return true
+		}
+	}
+	return false
+}
+
+// operand returns field value or number
+func operand(pod *PodInfo, value string) float64 {
+	if field, ok := podFields[value]; ok {
+		return field(pod)
+	}
+	number, _ := strconv.ParseFloat(value, 64)
+	return number
+}
+
+func (cond condition) matches(pod *PodInfo) bool {
+	left := operand(pod, cond.left)
+	right := operand(pod, cond.right)
+	switch cond.op {
+	case ">=":
+		return left >= right
+	case "<=":
+		return left <= right
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	case ">":
+		return left > right
+	case "<":
+		return left < right
+	}
+	return false
+}
+
+func (scope *Scope) matches(pod *PodInfo) bool {
+	if len(scope.Namespaces) > 0 && !containsString(scope.Namespaces, pod.Namespace) {
+		return false
+	}
+	if len(scope.WorkloadKinds) > 0 && !containsString(scope.WorkloadKinds, pod.WorkloadKind) {
+		return false
+	}
+	if len(scope.QOSClasses) > 0 && !containsString(scope.QOSClasses, pod.QOSClass) {
+		return false
+	}
+	return matchLabels(scope.NamespaceSelector, pod.NamespaceLabels) && matchLabels(scope.PodSelector, pod.Labels)
+}
+
+// Evaluate
+// Returns rules violated by pod. Pods without metrics are checked only by rules which do not use usage
+func (policy *Policy) Evaluate(pod *PodInfo) []PolicyFinding {
+	var findings []PolicyFinding
+	for _, rule := range policy.Rules {
+		if !rule.Scope.matches(pod) || rule.usage && !pod.Processed {
+			continue
+		}
+		violated := true
+		for _, cond := range rule.conditions {
+			if !cond.matches(pod) {
+				violated = false
+				break
+			}
+		}
+		if violated {
+			findings = append(findings, PolicyFinding{
+				Rule:     rule.Name,
+				Severity: rule.Severity,
+				Message:  rule.Message,
+			})
+		}
+	}
+	return findings
+}
+
+// severityLevel returns index of severity, -1 if it is unknown
+func severityLevel(severity string) int {
+	for i, known := range severities {
+		if known == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+func matchLabels(selector map[string]string, labels map[string]string) bool {
+	for key, value := range selector {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyViolation
+// Violated rule with affected workloads
+type PolicyViolation struct {
+	Rule      string
+	Severity  string
+	Message   string
+	Pods      int
+	Workloads []string // namespace/kind/name
+}
+
+// policyViolations groups findings of pods by rule, the most severe and widespread rules are the first
+func policyViolations(pods []PodInfo) []PolicyViolation {
+	var violations []PolicyViolation
+	index := map[string]int{}
+	workloads := map[string]map[string]bool{}
+	for _, pod := range pods {
+		for _, finding := range pod.PolicyFindings {
+			i, ok := index[finding.Rule]
+			if !ok {
+				violations = append(violations, PolicyViolation{
+					Rule:     finding.Rule,
+					Severity: finding.Severity,
+					Message:  finding.Message,
+				})
+				i = len(violations) - 1
+				index[finding.Rule] = i
+				workloads[finding.Rule] = map[string]bool{}
+			}
+			violations[i].Pods++
+			workload := workloadKey(pod.Namespace, pod.WorkloadKind, pod.Workload)
+			if !workloads[finding.Rule][workload] {
+				workloads[finding.Rule][workload] = true
+				violations[i].Workloads = append(violations[i].Workloads, workload)
+			}
+		}
+	}
+	for i := range violations {
+		sort.Strings(violations[i].Workloads)
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		if severityLevel(violations[i].Severity) != severityLevel(violations[j].Severity) {
+			return severityLevel(violations[i].Severity) > severityLevel(violations[j].Severity)
+		}
+		return violations[i].Pods > violations[j].Pods
+	})
+	return violations
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		err        bool
+		expected   condition
+		usage      bool
+	}{
+		{"field and number", "cpu.request_usage_ratio > 4", false, condition{"cpu.request_usage_ratio", ">", "4"}, true},
+		{"two fields", "cpu.limits != cpu.requests", false, condition{"cpu.limits", "!=", "cpu.requests"}, false},
+		{"two-character operator", "memory.headroom <= 0.1", false, condition{"memory.headroom", "<=", "0.1"}, true},
+		{"without spaces", "memory.limits==0", false, condition{"memory.limits", "==", "0"}, false},
+		{"spec and usage fields", "memory.limits < memory.working_set", false, condition{"memory.limits", "<", "memory.working_set"}, true},
+		{"unknown field", "cpu.unknown > 1", true, condition{}, false},
+		{"no operator", "cpu.limits", true, condition{}, false},
+		{"not a number", "cpu.limits > many", true, condition{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := parseCondition(test.expression)
+			if (err != nil) != test.err {
+				t.Fatalf("error is %v, expected error: %v", err, test.err)
+			}
+			if parsed != test.expected {
+				t.Errorf("condition is %+v, expected %+v", parsed, test.expected)
+			}
+			if parsed.usage() != test.usage {
+				t.Errorf("usage is %v, expected %v", parsed.usage(), test.usage)
+			}
+		})
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	rules := []Rule{
+		{Name: "guaranteed-limits", Scope: Scope{QOSClasses: []string{"Guaranteed"}}, When: []string{"cpu.limits != cpu.requests"}},
+		{Name: "memory-limit", When: []string{"memory.limits == 0"}},
+		{Name: "idle-requests", When: []string{"cpu.request_usage_ratio > 4"}},
+		{Name: "prod-only", Scope: Scope{Namespaces: []string{"prod"}, PodSelector: map[string]string{"tier": "web"}}, When: []string{"cpu.requests > 0", "memory.requests > 0"}},
+	}
+	policy := Policy{Rules: rules}
+	for i := range policy.Rules {
+		if err := policy.Rules[i].compile(); err != nil {
+			t.Fatalf("cannot compile rule %s: %v", policy.Rules[i].Name, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		pod      PodInfo
+		expected []string
+	}{
+		{"burstable pod is out of guaranteed scope",
+			PodInfo{QOSClass: "Burstable", Processed: true, CPURequsts: 100, CPULimits: 200, CPUMetric: 50, RAMLimits: 128},
+			nil},
+		{"guaranteed pod with different limits",
+			PodInfo{QOSClass: "Guaranteed", Processed: true, CPURequsts: 100, CPULimits: 200, CPUMetric: 50, RAMLimits: 128},
+			[]string{"guaranteed-limits"}},
+		{"requests without usage",
+			PodInfo{Processed: true, CPURequsts: 100, CPULimits: 100, RAMLimits: 128},
+			[]string{"idle-requests"}},
+		{"pod without metrics is checked by spec rules only",
+			PodInfo{CPURequsts: 100, CPULimits: 100},
+			[]string{"memory-limit"}},
+		{"all conditions and scope must match",
+			PodInfo{Namespace: "prod", Labels: map[string]string{"tier": "web"}, Processed: true, CPURequsts: 100, CPULimits: 100, CPUMetric: 100, RAMRequests: 64, RAMLimits: 128},
+			[]string{"prod-only"}},
+		{"pod selector does not match",
+			PodInfo{Namespace: "prod", Labels: map[string]string{"tier": "db"}, Processed: true, CPURequsts: 100, CPULimits: 100, CPUMetric: 100, RAMRequests: 64, RAMLimits: 128},
+			nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var rules []string
+			for _, finding := range policy.Evaluate(&test.pod) {
+				rules = append(rules, finding.Rule)
+			}
+			if len(rules) != len(test.expected) {
+				t.Fatalf("violated rules are %v, expected %v", rules, test.expected)
+			}
+			for i := range rules {
+				if rules[i] != test.expected[i] {
+					t.Errorf("violated rules are %v, expected %v", rules, test.expected)
+				}
+			}
+		})
+	}
+}
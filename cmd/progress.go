@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"sync/atomic"
+	"time"
+)
+
+// Progress
+// Counts processed pods and periodically logs how many are left
+type Progress struct {
+	total    int64
+	done     int64
+	failed   int64
+	start    time.Time
+	interval time.Duration
+	logger   *log.Entry
+}
+
+func CreateProgress(total int, interval time.Duration, logger *log.Entry) *Progress {
+	return &Progress{
+		total:    int64(total),
+		start:    time.Now(),
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+func (progress *Progress) Done() {
+	atomic.AddInt64(&progress.done, 1)
+}
+
+func (progress *Progress) Failed() {
+	atomic.AddInt64(&progress.failed, 1)
+}
+
+func (progress *Progress) Processed() int {
+	return int(atomic.LoadInt64(&progress.done))
+}
+
+// ETA
+// Estimates remaining time from the average speed since start
+func (progress *Progress) ETA() time.Duration {
+	done := atomic.LoadInt64(&progress.done) + atomic.LoadInt64(&progress.failed)
+	if done == 0 {
+		return 0
+	}
+	elapsed := time.Since(progress.start)
+	left := progress.total - done
+	return time.Duration(int64(elapsed) / done * left).Round(time.Second)
+}
+
+// Report
+// Logs progress until context is done, interval <= 0 disables logging
+func (progress *Progress) Report(ctx context.Context) {
+	if progress.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(progress.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			done := atomic.LoadInt64(&progress.done)
+			failed := atomic.LoadInt64(&progress.failed)
+			progress.logger.Infof("Processed %d/%d pods (%d failed), ETA %s", done, progress.total, failed, progress.ETA())
+		}
+	}
+}
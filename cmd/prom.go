@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	log "github.com/sirupsen/logrus"
@@ -13,12 +14,17 @@ import (
 )
 
 type Prometheus struct {
-	server   *url.URL
-	username string
-	password string
-	timeout  time.Duration
-	isAuth   bool
-	logger   *log.Entry
+	server     *url.URL
+	username   string
+	password   string
+	timeout    time.Duration
+	isAuth     bool
+	limiter    *QueryLimiter
+	maxRetries int
+	cache      *QueryCache
+	evalTime   time.Time
+	metricsQL  bool
+	logger     *log.Entry
 }
 
 type Response struct {
@@ -35,13 +41,14 @@ type Data struct {
 }
 
 type Result struct {
-	Metric interface{} `json:"metric,omitempty"`
-	Value  *Value      `json:"value"`
+	Metric map[string]string `json:"metric,omitempty"`
+	Value  *Value            `json:"value"`
+	Values []Value           `json:"values,omitempty"` // Range query samples
 }
 
 type Value [2]interface{}
 
-func PromCreate(server string, username string, password string, timeout time.Duration, logger *log.Entry) (*Prometheus, error) {
+func PromCreate(server string, username string, password string, timeout time.Duration, limiter *QueryLimiter, maxRetries int, logger *log.Entry) (*Prometheus, error) {
 	var prom = Prometheus{}
 	serverUrlString := fmt.Sprintf("http://%s/api/v1/query", server)
 	serverUrl, err := url.Parse(serverUrlString)
@@ -55,37 +62,164 @@ func PromCreate(server string, username string, password string, timeout time.Du
 	}
 	prom.server = serverUrl
 	prom.timeout = timeout
+	prom.limiter = limiter
+	prom.maxRetries = maxRetries
+	prom.evalTime = time.Now()
 	prom.logger = logger
 	return &prom, nil
 }
 
-func (prom *Prometheus) InstanceQuery(query string) (*interface{}, error) {
-	client := &http.Client{Timeout: prom.timeout}
-	var data = url.Values{}
-	var result = Response{}
-	var zeroResult interface{} = "0"
+// VMCreate
+// Creates client for VictoriaMetrics, tenant is "accountID[:projectID]" for cluster version, empty for single node
+func VMCreate(server string, tenant string, username string, password string, timeout time.Duration, limiter *QueryLimiter, maxRetries int, logger *log.Entry) (*Prometheus, error) {
+	prom, err := PromCreate(server, username, password, timeout, limiter, maxRetries, logger)
+	if err != nil {
+		return nil, err
+	}
+	if tenant != "" {
+		prom.server, err = url.Parse(fmt.Sprintf("http://%s/select/%s/prometheus/api/v1/query", server, tenant))
+		if err != nil {
+			return nil, err
+		}
+	}
+	prom.metricsQL = true
+	return prom, nil
+}
 
-	data.Set("query", query)
-	prom.logger.Debugf("Qyery is %v", query)
-	req, err := http.NewRequest("POST", prom.server.String(), strings.NewReader(data.Encode()))
+// MetricsQL
+// Backend understands MetricsQL extensions
+func (prom *Prometheus) MetricsQL() bool {
+	return prom.metricsQL
+}
+
+// SetCache
+// Enables responses caching, evaluation time is used for cache key
+func (prom *Prometheus) SetCache(cache *QueryCache) {
+	prom.cache = cache
+}
 
+// SetEvalTime
+// Pins evaluation time for all queries, so every pod is evaluated at the same moment
+func (prom *Prometheus) SetEvalTime(evalTime time.Time) {
+	prom.evalTime = evalTime
+}
+
+func (prom *Prometheus) EvalTime() time.Time {
+	return prom.evalTime
+}
+
+func (prom *Prometheus) InstanceQuery(ctx context.Context, query string) (*interface{}, error) {
+	var zeroResult interface{} = "0"
+
+	results, err := prom.VectorQuery(ctx, query)
 	if err != nil {
 		return nil, err
 	}
-	if prom.isAuth {
-		req.SetBasicAuth(prom.username, prom.password)
-		req.BasicAuth()
+	if len(results) > 0 {
+		//prom.logger.Debugf("Result is %v", results)
+		return &results[0].Value[1], nil
 	}
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
-	resp, err := client.Do(req)
-	prom.logger.Debugf("Response status: %d", resp.StatusCode)
-	prom.logger.Debugf("Response headers: %v", resp.Header)
+	return &zeroResult, nil
+}
+
+// VectorQuery
+// Returns all series of instant query result
+func (prom *Prometheus) VectorQuery(ctx context.Context, query string) ([]Result, error) {
+	var data = url.Values{}
+	data.Set("query", query)
+	data.Set("time", formatPromTime(prom.evalTime))
+	return prom.fetch(ctx, prom.server.String(), query, query, data, prom.limiter.Cost(query))
+}
+
+// RangeQuery
+// Returns all series of range query result over the window before evaluation time
+func (prom *Prometheus) RangeQuery(ctx context.Context, query string, window time.Duration, step time.Duration) ([]Result, error) {
+	var data = url.Values{}
+	data.Set("query", query)
+	data.Set("start", formatPromTime(prom.evalTime.Add(-window)))
+	data.Set("end", formatPromTime(prom.evalTime))
+	data.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	// Start depends on evaluation time, so window and step are cached and cache applies its time bucket
+	cacheQuery := fmt.Sprintf("%s[%s:%s]", query, window, step)
+	return prom.fetch(ctx, strings.TrimSuffix(prom.server.String(), "/query")+"/query_range", query, cacheQuery, data, prom.limiter.RangeCost(query, window, step))
+}
+
+// fetch sends request or takes response from cache by cacheQuery, only successful responses are cached. Cost is charged to limiter
+func (prom *Prometheus) fetch(ctx context.Context, endpoint string, query string, cacheQuery string, data url.Values, cost int) ([]Result, error) {
+	var result = Response{}
+	var body []byte
+	var cached bool
+	var err error
+
+	prom.logger.Debugf("Qyery is %v", query)
+	if prom.cache != nil {
+		body, cached = prom.cache.Get(prom.server.String(), cacheQuery, prom.evalTime)
+	}
+	if !cached {
+		body, err = prom.request(ctx, endpoint, data, cost)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = json.Unmarshal(body, &result)
 	if err != nil {
 		return nil, err
 	}
+	if result.Status != "success" || result.Data == nil {
+		return nil, fmt.Errorf("query failed: %s %s", result.ErrorType, result.Error)
+	}
+	if prom.cache != nil && !cached {
+		if err := prom.cache.Put(prom.server.String(), cacheQuery, prom.evalTime, body); err != nil {
+			prom.logger.Warnf("Cannot save response to cache: %v", err)
+		}
+	}
+	return result.Data.Result, nil
+}
+
+// formatPromTime formats time as unix timestamp with milliseconds
+func formatPromTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
+
+func (prom *Prometheus) request(ctx context.Context, endpoint string, data url.Values, cost int) ([]byte, error) {
+	client := &http.Client{Timeout: prom.timeout}
+
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		if err := prom.limiter.Wait(ctx, cost); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(data.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		if prom.isAuth {
+			req.SetBasicAuth(prom.username, prom.password)
+			req.BasicAuth()
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
+		resp, err = client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		prom.logger.Debugf("Response status: %d", resp.StatusCode)
+		prom.logger.Debugf("Response headers: %v", resp.Header)
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= prom.maxRetries {
+			break
+		}
+		resp.Body.Close()
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+		if retryAfter <= 0 {
+			retryAfter = time.Duration(attempt+1) * time.Second
+		}
+		prom.logger.Warnf("Server asks to slow down, retrying in %s", retryAfter)
+		prom.limiter.Hold(retryAfter)
+	}
+	defer resp.Body.Close()
+
 	if resp.StatusCode > 399 {
-		err = fmt.Errorf("server returns %s", resp.Status)
+		err := fmt.Errorf("server returns %s", resp.Status)
 		return nil, err
 	}
 	body, err := ioutil.ReadAll(resp.Body)
@@ -93,13 +227,5 @@ func (prom *Prometheus) InstanceQuery(query string) (*interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = json.Unmarshal(body, &result)
-	if err != nil {
-		return nil, err
-	}
-	if len(result.Data.Result) > 0 {
-		//prom.logger.Debugf("Result is %v", result.Data.Result)
-		return &result.Data.Result[0].Value[1], err
-	}
-	return &zeroResult, nil
+	return body, nil
 }
@@ -0,0 +1,337 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PromMetrics
+// MetricsSource implementation for Prometheus and VictoriaMetrics
+type PromMetrics struct {
+	prom    *Prometheus
+	options MetricsOptions
+}
+
+// podQuery
+// Named query which returns single value for a pod, or one value per container or quantile
+type podQuery struct {
+	name  string
+	query string
+}
+
+// Quantiles which are requested from VictoriaMetrics
+const vmQuantiles = "0.5, 0.95, 0.99"
+
+func CreatePromMetrics(prom *Prometheus, options MetricsOptions) *PromMetrics {
+	return &PromMetrics{
+		prom:    prom,
+		options: options,
+	}
+}
+
+func (source *PromMetrics) EvalTime() time.Time {
+	return source.prom.EvalTime()
+}
+
+func (source *PromMetrics) Options() MetricsOptions {
+	return source.options
+}
+
+func (source *PromMetrics) PodUsage(ctx context.Context, dc string, pod *PodInfo) (*PodUsage, error) {
+	values, err := source.runQueries(ctx, source.podQueries(dc, pod))
+	if err != nil {
+		return nil, err
+	}
+	// Pending, just started and not scraped pods have no series
+	_, cpu := values["cpu"]
+	_, ram := values["ram"]
+	if !cpu && !ram {
+		return nil, fmt.Errorf("%w: no cpu and ram series for pod %s/%s", ErrNoMetrics, pod.Namespace, pod.Name)
+	}
+	usage := PodUsage{
+		CPU:          values["cpu"],
+		RAM:          values["ram"],
+		CPUAverage:   values["cpu_avg"],
+		RAMAverage:   values["ram_avg"],
+		Throttling:   values["throttling"],
+		NetRx:        values["net_rx"],
+		NetTx:        values["net_tx"],
+		FsRead:       values["fs_read"],
+		FsWrite:      values["fs_write"],
+		CPUQuantiles: map[string]float64{},
+		RAMQuantiles: map[string]float64{},
+		Containers:   map[string]ContainerUsage{},
+	}
+	workingSet, ok := values["working_set"]
+	if !ok {
+		workingSet = values["ram"]
+	}
+	usage.WorkingSet = workingSet
+	for name, value := range values {
+		parts := strings.SplitN(name, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "cpu_quantiles":
+			usage.CPUQuantiles[parts[1]] = value
+		case "ram_quantiles":
+			usage.RAMQuantiles[parts[1]] = value
+		case "container_cpu":
+			container := usage.Containers[parts[1]]
+			container.CPU = value
+			usage.Containers[parts[1]] = container
+		case "container_ram":
+			container := usage.Containers[parts[1]]
+			container.RAM = value
+			usage.Containers[parts[1]] = container
+		case "container_cpu_quantiles", "container_ram_quantiles":
+			// Only the configured percentile of containers is used, for recommendations
+			separator := strings.LastIndex(parts[1], ":")
+			if separator < 0 {
+				continue
+			}
+			phi, err := strconv.ParseFloat(parts[1][separator+1:], 64)
+			if err != nil || phi != source.options.Percentile {
+				continue
+			}
+			name := parts[1][:separator]
+			container := usage.Containers[name]
+			if parts[0] == "container_cpu_quantiles" {
+				container.CPU = value
+			} else {
+				container.RAM = value
+			}
+			usage.Containers[name] = container
+		case "container_working_set":
+			container := usage.Containers[parts[1]]
+			container.WorkingSetPeak = value
+			usage.Containers[parts[1]] = container
+		case "container_growth":
+			container := usage.Containers[parts[1]]
+			container.WorkingSetGrowth = value
+			usage.Containers[parts[1]] = container
+		}
+	}
+	if source.options.OOMPrediction {
+		if err := source.workingSetSeries(ctx, pod, &usage); err != nil {
+			return nil, err
+		}
+	}
+	return &usage, nil
+}
+
+// workingSetSeries fills working set series of containers, it needs a range query
+func (source *PromMetrics) workingSetSeries(ctx context.Context, pod *PodInfo, usage *PodUsage) error {
+	results, err := source.prom.RangeQuery(ctx, memoryUsage(pod, []string{"working_set"}, "container"), oomWindow, oomStep)
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		name := result.Metric["container"]
+		container := usage.Containers[name]
+		for _, value := range result.Values {
+			sample, ok := parseSample(value)
+			if ok {
+				container.WorkingSet = append(container.WorkingSet, sample)
+			}
+		}
+		usage.Containers[name] = container
+	}
+	return nil
+}
+
+// parseSample parses [timestamp, "value"] pair, NaN and infinite values are skipped
+func parseSample(value Value) (Sample, bool) {
+	timestamp, ok := value[0].(float64)
+	if !ok {
+		return Sample{}, false
+	}
+	number, err := strconv.ParseFloat(fmt.Sprintf("%v", value[1]), 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return Sample{}, false
+	}
+	return Sample{Time: time.Unix(0, int64(timestamp*1e9)), Value: number}, true
+}
+
+// podQueries returns all queries which are needed for a pod with current metrics options
+func (source *PromMetrics) podQueries(dc string, pod *PodInfo) []podQuery {
+	cpuUsage := fmt.Sprintf("sum(rate(container_cpu_usage_seconds_total{datacenter=\"%s\",namespace=\"%s\", pod=\"%s\", id=~\".*%s.*\"}))",
+		dc,
+		pod.Namespace,
+		pod.Name,
+		pod.Uid)
+	containerCPUUsage := fmt.Sprintf("sum by (container) (rate(container_cpu_usage_seconds_total{datacenter=\"%s\",namespace=\"%s\", pod=\"%s\", container!=\"\", id=~\".*%s.*\"}))",
+		dc,
+		pod.Namespace,
+		pod.Name,
+		pod.Uid)
+	containerRAMUsage := memoryUsage(pod, source.options.MemoryMetrics, "container")
+	queries := []podQuery{
+		{"cpu", fmt.Sprintf("max_over_time(%s[7d:1m])", cpuUsage)},
+		{"ram", fmt.Sprintf("max_over_time(%s[7d:1m])", memoryUsage(pod, source.options.MemoryMetrics, ""))},
+	}
+
+	// Containers usage is used for recommendations, so it can be a percentile instead of peak.
+	// MetricsQL returns the percentile together with quantiles of the report in one query
+	switch {
+	case source.options.Percentile > 0 && source.prom.MetricsQL():
+		phis := vmQuantiles
+		if percentile := fmt.Sprintf("%g", source.options.Percentile); !containsString(strings.Split(vmQuantiles, ", "), percentile) {
+			phis = percentile + ", " + vmQuantiles
+		}
+		queries = append(queries,
+			podQuery{"container_cpu_quantiles", fmt.Sprintf("quantiles_over_time(\"phi\", %s, %s[7d:1m])", phis, containerCPUUsage)},
+			podQuery{"container_ram_quantiles", fmt.Sprintf("quantiles_over_time(\"phi\", %s, %s[7d:1m])", phis, containerRAMUsage)},
+		)
+	case source.options.Percentile > 0:
+		queries = append(queries,
+			podQuery{"container_cpu", fmt.Sprintf("quantile_over_time(%g, %s[7d:1m])", source.options.Percentile, containerCPUUsage)},
+			podQuery{"container_ram", fmt.Sprintf("quantile_over_time(%g, %s[7d:1m])", source.options.Percentile, containerRAMUsage)},
+		)
+	default:
+		queries = append(queries,
+			podQuery{"container_cpu", fmt.Sprintf("max_over_time(%s[7d:1m])", containerCPUUsage)},
+			podQuery{"container_ram", fmt.Sprintf("max_over_time(%s[7d:1m])", containerRAMUsage)},
+		)
+	}
+
+	// Kubelet and OOM killer look at working set, so it is used for limit headroom and recommended memory limits
+	if len(source.options.MemoryMetrics) != 1 || source.options.MemoryMetrics[0] != "working_set" {
+		queries = append(queries, podQuery{"working_set", fmt.Sprintf("max_over_time(%s[7d:1m])", memoryUsage(pod, []string{"working_set"}, ""))})
+	}
+	queries = append(queries, podQuery{"container_working_set", fmt.Sprintf("max_over_time(%s[7d:1m])", memoryUsage(pod, []string{"working_set"}, "container"))})
+	// Without OOM prediction series idle workloads still need working set trend
+	if !source.options.OOMPrediction {
+		queries = append(queries, podQuery{"container_growth", fmt.Sprintf("deriv(%s[7d:1h])", memoryUsage(pod, []string{"working_set"}, "container"))})
+	}
+
+	if source.options.Average {
+		queries = append(queries,
+			podQuery{"cpu_avg", fmt.Sprintf("avg_over_time(%s[7d:1m])", cpuUsage)},
+			podQuery{"ram_avg", fmt.Sprintf("avg_over_time(%s[7d:1m])", memoryUsage(pod, source.options.MemoryMetrics, ""))},
+		)
+	}
+
+	if source.options.Throttling {
+		// Ratio of the most throttled container in the pod
+		queries = append(queries, podQuery{"throttling", fmt.Sprintf("max(sum by (container) (increase(container_cpu_cfs_throttled_periods_total{datacenter=\"%[1]s\",namespace=\"%[2]s\", pod=\"%[3]s\", container!=\"\", id=~\".*%[4]s.*\"}[7d])) / sum by (container) (increase(container_cpu_cfs_periods_total{datacenter=\"%[1]s\",namespace=\"%[2]s\", pod=\"%[3]s\", container!=\"\", id=~\".*%[4]s.*\"}[7d])))",
+			dc,
+			pod.Namespace,
+			pod.Name,
+			pod.Uid)})
+	}
+
+	// Average rates over the window, bytes per second
+	rates := map[string]string{}
+	if source.options.Network {
+		rates["net_rx"] = "container_network_receive_bytes_total"
+		rates["net_tx"] = "container_network_transmit_bytes_total"
+	}
+	if source.options.Disk {
+		rates["fs_read"] = "container_fs_reads_bytes_total"
+		rates["fs_write"] = "container_fs_writes_bytes_total"
+	}
+	// Sorted, so union of MetricsQL queries and its cache key are the same between runs
+	var names []string
+	for name := range rates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		queries = append(queries, podQuery{name, fmt.Sprintf("sum(rate(%s{datacenter=\"%s\",namespace=\"%s\", pod=\"%s\", id=~\".*%s.*\"}[7d]))",
+			rates[name],
+			dc,
+			pod.Namespace,
+			pod.Name,
+			pod.Uid)})
+	}
+
+	// MetricsQL can return several quantiles in one query
+	if source.prom.MetricsQL() {
+		queries = append(queries,
+			podQuery{"cpu_quantiles", fmt.Sprintf("quantiles_over_time(\"phi\", %s, %s[7d:1m])", vmQuantiles, cpuUsage)},
+			podQuery{"ram_quantiles", fmt.Sprintf("quantiles_over_time(\"phi\", %s, %s[7d:1m])", vmQuantiles, memoryUsage(pod, source.options.MemoryMetrics, ""))},
+		)
+	}
+	return queries
+}
+
+// runQueries
+// Executes queries one by one, or in a single round trip when backend supports MetricsQL.
+// Series with "container" or "phi" label are returned as "name:container", "name:phi" or "name:container:phi"
+func (source *PromMetrics) runQueries(ctx context.Context, queries []podQuery) (map[string]float64, error) {
+	values := map[string]float64{}
+	if !source.prom.MetricsQL() {
+		for _, query := range queries {
+			results, err := source.prom.VectorQuery(ctx, query.query)
+			if err != nil {
+				return nil, err
+			}
+			for _, result := range results {
+				storeResult(values, query.name, result)
+			}
+		}
+		return values, nil
+	}
+
+	var parts []string
+	for _, query := range queries {
+		parts = append(parts, fmt.Sprintf("label_set(%s, \"podreporter_query\", \"%s\")", query.query, query.name))
+	}
+	results, err := source.prom.VectorQuery(ctx, fmt.Sprintf("union(%s)", strings.Join(parts, ", ")))
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		storeResult(values, result.Metric["podreporter_query"], result)
+	}
+	return values, nil
+}
+
+// storeResult saves series value, NaN and infinite values are zero
+func storeResult(values map[string]float64, name string, result Result) {
+	if result.Value == nil {
+		return
+	}
+	if container, ok := result.Metric["container"]; ok {
+		name += ":" + container
+	}
+	if phi, ok := result.Metric["phi"]; ok {
+		name += ":" + phi
+	}
+	value, _ := strconv.ParseFloat(fmt.Sprintf("%v", result.Value[1]), 64)
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		value = 0
+	}
+	values[name] = value
+}
+
+// memoryUsage returns sum of memory metrics, optionally grouped by label
+func memoryUsage(pod *PodInfo, metrics []string, by string) string {
+	var parts []string
+	if len(metrics) == 0 {
+		metrics = []string{"rss"}
+	}
+	grouping := ""
+	filter := ""
+	if by != "" {
+		grouping = fmt.Sprintf(" by (%s) ", by)
+		filter = fmt.Sprintf(", %s!=\"\"", by)
+	}
+	for _, metric := range metrics {
+		parts = append(parts, fmt.Sprintf("sum%s(%s{namespace=\"%s\",pod=\"%s\"%s, id=~\".*%s.*\"})",
+			grouping,
+			MemoryMetrics[metric],
+			pod.Namespace,
+			pod.Name,
+			filter,
+			pod.Uid))
+	}
+	return fmt.Sprintf("(%s)", strings.Join(parts, " + "))
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// RecommendOptions
+// How recommendations are calculated from usage. CPU values are in millicores, RAM values are in Mi
+type RecommendOptions struct {
+	Headroom       float64 // Part of usage added to requests, 0.2 is 20%
+	CPULimitFactor float64 // Limits are requests multiplied by factor, 0 - keep current limits
+	RAMLimitFactor float64
+	CPUStep        float64 // Values are rounded up to the step
+	RAMStep        float64
+}
+
+func DefaultRecommendOptions() RecommendOptions {
+	return RecommendOptions{
+		Headroom:       0.2,
+		CPULimitFactor: 2,
+		RAMLimitFactor: 1.5,
+		CPUStep:        50,
+		RAMStep:        64,
+	}
+}
+
+// Change
+// Current and recommended value of a resource
+type Change struct {
+	Current     float64
+	Recommended float64
+}
+
+func (change Change) Delta() float64 {
+	return change.Recommended - change.Current
+}
+
+// Format formats change like "500m → 150m (-350m)"
+func (change Change) Format(unit string) string {
+	return fmt.Sprintf("%.0f%s → %.0f%s (%+.0f%s)", change.Current, unit, change.Recommended, unit, change.Delta(), unit)
+}
+
+// Recommendation
+// Resources of a container in workload, usage is the highest among workload pods
+type Recommendation struct {
+	Datacenter   string
+	Namespace    string
+	WorkloadKind string
+	Workload     string
+	Container    string
+	Pods         int
+	CPUUsage     float64
+	RAMUsage     float64
+	WorkingSet   float64 // Peak working set, OOM killer compares it with the limit
+	CPURequests  Change
+	CPULimits    Change
+	RAMRequests  Change
+	RAMLimits    Change
+}
+
+type RecommendationBySavingsDesc []Recommendation
+
+// Recommend
+// Calculates recommendations for every container of every workload, pods without metrics are skipped
+func Recommend(dc string, pods []PodInfo, options RecommendOptions) []Recommendation {
+	var recommendations []Recommendation
+	index := map[string]int{}
+	ignored := map[int]map[string]bool{}
+
+	for _, pod := range pods {
+		if !pod.Processed {
+			continue
+		}
+		for _, container := range pod.Containers {
+			if !container.Processed {
+				continue
+			}
+			key := workloadKey(pod.Namespace, pod.WorkloadKind, pod.Workload) + "/" + container.Name
+			i, ok := index[key]
+			if !ok {
+				recommendations = append(recommendations, Recommendation{
+					Datacenter:   dc,
+					Namespace:    pod.Namespace,
+					WorkloadKind: pod.WorkloadKind,
+					Workload:     pod.Workload,
+					Container:    container.Name,
+				})
+				i = len(recommendations) - 1
+				index[key] = i
+				ignored[i] = map[string]bool{}
+			}
+			for finding := range pod.Ignored {
+				ignored[i][finding] = true
+			}
+			recommendation := &recommendations[i]
+			recommendation.Pods++
+			recommendation.CPUUsage = math.Max(recommendation.CPUUsage, container.CPUMetric)
+			recommendation.RAMUsage = math.Max(recommendation.RAMUsage, container.RAMMetric)
+			recommendation.WorkingSet = math.Max(recommendation.WorkingSet, container.WorkingSetPeak)
+			recommendation.CPURequests.Current = math.Max(recommendation.CPURequests.Current, container.CPURequsts)
+			recommendation.CPULimits.Current = math.Max(recommendation.CPULimits.Current, container.CPULimits)
+			recommendation.RAMRequests.Current = math.Max(recommendation.RAMRequests.Current, container.RAMRequests)
+			recommendation.RAMLimits.Current = math.Max(recommendation.RAMLimits.Current, container.RAMLimits)
+		}
+	}
+
+	for i := range recommendations {
+		recommendations[i].calculate(options)
+		recommendations[i].keepIgnored(ignored[i])
+	}
+	return recommendations
+}
+
+func (recommendation *Recommendation) calculate(options RecommendOptions) {
+	recommendation.CPURequests.Recommended = roundUp(recommendation.CPUUsage*(1+options.Headroom), options.CPUStep)
+	recommendation.RAMRequests.Recommended = roundUp(recommendation.RAMUsage*(1+options.Headroom), options.RAMStep)
+
+	recommendation.CPULimits.Recommended = recommendation.CPULimits.Current
+	if options.CPULimitFactor > 0 {
+		recommendation.CPULimits.Recommended = roundUp(recommendation.CPURequests.Recommended*options.CPULimitFactor, options.CPUStep)
+	}
+	// RAM usage can be rss, which is less than working set, so limit also covers peak working set with headroom
+	recommendation.RAMLimits.Recommended = recommendation.RAMLimits.Current
+	if options.RAMLimitFactor > 0 {
+		recommendation.RAMLimits.Recommended = roundUp(math.Max(
+			recommendation.RAMRequests.Recommended*options.RAMLimitFactor,
+			recommendation.WorkingSet*(1+options.Headroom)), options.RAMStep)
+	}
+}
+
+// keepIgnored keeps current values of resources with suppressed findings
+func (recommendation *Recommendation) keepIgnored(ignored map[string]bool) {
+	if ignored[IgnoreCPURequests] {
+		recommendation.CPURequests.Recommended = recommendation.CPURequests.Current
+	}
+	if ignored[IgnoreCPULimits] {
+		recommendation.CPULimits.Recommended = recommendation.CPULimits.Current
+	}
+	if ignored[IgnoreMemoryRequests] {
+		recommendation.RAMRequests.Recommended = recommendation.RAMRequests.Current
+	}
+	if ignored[IgnoreMemoryLimits] {
+		recommendation.RAMLimits.Recommended = recommendation.RAMLimits.Current
+	}
+}
+
+// Changed returns true, if any recommended value differs from the current one
+func (recommendation *Recommendation) Changed() bool {
+	for _, change := range []Change{recommendation.CPURequests, recommendation.CPULimits, recommendation.RAMRequests, recommendation.RAMLimits} {
+		if change.Delta() != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// roundUp rounds value up to the step, result is never less than one step
+func roundUp(value float64, step float64) float64 {
+	if step <= 0 {
+		return math.Ceil(value)
+	}
+	return math.Max(step, math.Ceil(value/step)*step)
+}
+
+// Sorting recommendations, the biggest absolute changes of requests are the first
+func (recommendations RecommendationBySavingsDesc) Len() int { return len(recommendations) }
+
+func (recommendations RecommendationBySavingsDesc) Less(i, j int) bool {
+	return recommendations[i].weight() > recommendations[j].weight()
+}
+
+func (recommendations RecommendationBySavingsDesc) Swap(i, j int) {
+	recommendations[i], recommendations[j] = recommendations[j], recommendations[i]
+}
+
+// weight compares CPU and RAM changes, 1 core is weighted as 1Gi
+func (recommendation *Recommendation) weight() float64 {
+	return math.Abs(recommendation.CPURequests.Delta())*float64(recommendation.Pods) + math.Abs(recommendation.RAMRequests.Delta())*float64(recommendation.Pods)*1000/1024
+}
+
+// workloadKey returns key of workload like namespace/Deployment/name
+func workloadKey(namespace string, kind string, name string) string {
+	return fmt.Sprintf("%s/%s/%s", namespace, kind, name)
+}
+
+// recommendationsByWorkload groups recommendations by workload key, containers are sorted by name
+func recommendationsByWorkload(recommendations []Recommendation) map[string][]Recommendation {
+	result := map[string][]Recommendation{}
+	for _, recommendation := range recommendations {
+		key := workloadKey(recommendation.Namespace, recommendation.WorkloadKind, recommendation.Workload)
+		result[key] = append(result[key], recommendation)
+	}
+	for key := range result {
+		containers := result[key]
+		sort.SliceStable(containers, func(i, j int) bool { return containers[i].Container < containers[j].Container })
+	}
+	return result
+}
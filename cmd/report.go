@@ -0,0 +1,524 @@
+package cmd
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report
+// Format independent report, sinks render it. Sections contain all rows, sinks decide how many to show
+type Report struct {
+	Title       string
+	GeneratedAt time.Time
+	EvalTime    time.Time // Moment when usage was evaluated
+	Processed   int       // Pods with metrics
+	Total       int
+	Currency    string // Empty if cost is not estimated
+	PointInTime bool   // Usage is current, not the peak over the window
+	Datacenters []DatacenterReport
+	Appendix    []Section
+
+	sections func(dc Datacenter, now time.Time) []Section // Builds sections of datacenter pods, used for team reports
+}
+
+// DatacenterReport
+// Summary, sections and raw data of a datacenter
+type DatacenterReport struct {
+	Name            string
+	Summary         Summary
+	Sections        []Section
+	Pods            []PodInfo // All pods, including pods without metrics
+	Recommendations []Recommendation
+}
+
+// Section
+// Titled table, rows are already formatted
+type Section struct {
+	ID      string
+	Title   string
+	Columns []string
+	Rows    [][]string
+}
+
+// Partial returns true, if metrics were not received for all pods
+func (report *Report) Partial() bool {
+	return report.Processed < report.Total
+}
+
+// UsageNote describes what usage values mean
+func (report *Report) UsageNote() string {
+	if report.PointInTime {
+		return "usage is point-in-time"
+	}
+	return "usage is the peak over 7 days"
+}
+
+// ForTeam
+// Returns report of team pods with sections and suppressions built from them.
+// Overcommit is not known, as nodes are shared by teams
+func (report *Report) ForTeam(team string) *Report {
+	teamReport := Report{
+		Title:       report.Title + " for " + team,
+		GeneratedAt: report.GeneratedAt,
+		EvalTime:    report.EvalTime,
+		Currency:    report.Currency,
+		PointInTime: report.PointInTime,
+		sections:    report.sections,
+	}
+	for _, dc := range report.Datacenters {
+		pods := filterPods(dc.Pods, func(pod PodInfo) bool { return pod.Team == team })
+		if len(pods) == 0 {
+			continue
+		}
+		workloads := map[string]bool{}
+		for _, pod := range pods {
+			workloads[workloadKey(pod.Namespace, pod.WorkloadKind, pod.Workload)] = true
+			teamReport.Total++
+			if pod.Processed {
+				teamReport.Processed++
+			}
+		}
+		var recommendations []Recommendation
+		for _, recommendation := range dc.Recommendations {
+			if workloads[workloadKey(recommendation.Namespace, recommendation.WorkloadKind, recommendation.Workload)] {
+				recommendations = append(recommendations, recommendation)
+			}
+		}
+		var sections []Section
+		if report.sections != nil {
+			sections = report.sections(Datacenter{Name: dc.Name, pods: pods, recommendations: recommendations}, report.GeneratedAt)
+		}
+		teamReport.Datacenters = append(teamReport.Datacenters, DatacenterReport{
+			Name:            dc.Name,
+			Summary:         Summarize(pods),
+			Sections:        sections,
+			Pods:            pods,
+			Recommendations: recommendations,
+		})
+		if section, ok := suppressionsSection(dc.Name, pods, report.GeneratedAt); ok {
+			teamReport.Appendix = append(teamReport.Appendix, section)
+		}
+	}
+	return &teamReport
+}
+
+// Teams returns sorted teams of all pods
+func (report *Report) Teams() []string {
+	var teams []string
+	found := map[string]bool{}
+	for _, dc := range report.Datacenters {
+		for _, pod := range dc.Pods {
+			if !found[pod.Team] {
+				found[pod.Team] = true
+				teams = append(teams, pod.Team)
+			}
+		}
+	}
+	sort.Strings(teams)
+	return teams
+}
+
+// BuildReport
+// Builds report from collected data, must be called after FillRecommendations
+func (reporter *PodReporter) BuildReport() *Report {
+	report := Report{
+		Title:       "Daily kubernetes resources news",
+		GeneratedAt: time.Now(),
+		EvalTime:    reporter.source.EvalTime(),
+		Processed:   reporter.processed,
+		Total:       reporter.total,
+		PointInTime: reporter.source.Options().PointInTime,
+		sections:    reporter.datacenterSections,
+	}
+	if reporter.pricing != nil {
+		report.Currency = reporter.pricing.Currency
+	}
+	for _, dc := range reporter.Datacenters {
+		report.Datacenters = append(report.Datacenters, DatacenterReport{
+			Name:            dc.Name,
+			Summary:         dc.Summary(),
+			Sections:        reporter.datacenterSections(dc, report.GeneratedAt),
+			Pods:            dc.pods,
+			Recommendations: dc.recommendations,
+		})
+	}
+
+	// Appendix with suppressions, expired ones are the first so they are not forgotten
+	for _, dc := range reporter.Datacenters {
+		if section, ok := suppressionsSection(dc.Name, dc.pods, report.GeneratedAt); ok {
+			report.Appendix = append(report.Appendix, section)
+		}
+	}
+	return &report
+}
+
+// suppressionsSection returns suppressions of pods, false if there are none
+func suppressionsSection(dc string, pods []PodInfo, now time.Time) (Section, bool) {
+	suppressions := activeSuppressions(pods, now)
+	if len(suppressions) == 0 {
+		return Section{}, false
+	}
+	section := Section{
+		ID:      dc + "-Suppressions",
+		Title:   fmt.Sprintf("Suppressions in %s", strings.ToUpper(dc)),
+		Columns: []string{"Object", "Findings", "Expiry", "Reason", "Pods"},
+	}
+	for _, suppression := range suppressions {
+		section.Rows = append(section.Rows, []string{
+			suppression.Object(),
+			strings.Join(suppression.Findings, ", "),
+			suppression.Expiry(),
+			suppression.Reason,
+			fmt.Sprint(suppression.Pods),
+		})
+	}
+	return section, true
+}
+
+// datacenterSections returns sections of pods with metrics
+func (reporter *PodReporter) datacenterSections(dc Datacenter, now time.Time) []Section {
+	var sections []Section
+	bestEffort := filterPods(dc.pods, func(pod PodInfo) bool {
+		return pod.QOSClass == string(corev1.PodQOSBestEffort) && matchNamespace(reporter.bestEffortDenied, pod.Namespace)
+	})
+	pods := processedPods(dc.pods)
+
+	// Sort by CPU
+	sort.Sort(PodByMetricCPUDesc(pods))
+	section := Section{ID: dc.Name + "-CPU", Title: "Top pods by CPU", Columns: []string{"Ns", "Pod", "CPU", "Limits", "p95"}}
+	for _, pod := range pods {
+		section.Rows = append(section.Rows, []string{
+			pod.Namespace,
+			pod.Name,
+			fmt.Sprintf("%.1fm", pod.CPUMetric),
+			fmt.Sprintf("%.1fm", pod.CPULimits),
+			formatQuantile(pod.CPUQuantiles, "0.95", "m"),
+		})
+	}
+	sections = append(sections, section)
+
+	// Sort By RAM
+	sort.Sort(PodByMetricRAMDesc(pods))
+	section = Section{ID: dc.Name + "-RAM", Title: "Top pods by RAM", Columns: []string{"Ns", "Pod", "RAM", "Limits", "p95"}}
+	for _, pod := range pods {
+		section.Rows = append(section.Rows, []string{
+			pod.Namespace,
+			pod.Name,
+			fmt.Sprintf("%.1fMi", pod.RAMMetric),
+			fmt.Sprintf("%.1fMi", pod.RAMLimits),
+			formatQuantile(pod.RAMQuantiles, "0.95", "Mi"),
+		})
+	}
+	sections = append(sections, section)
+
+	// Sort by working set to limit ratio
+	limited := filterPods(pods, func(pod PodInfo) bool { return pod.RAMLimits > 0 })
+	sort.Sort(PodByLimitUsageRAMDesc(limited))
+	section = Section{ID: dc.Name + "-Headroom", Title: "Pods with the least memory headroom", Columns: []string{"Ns", "Pod", "Working set", "Limits", "Headroom"}}
+	for _, pod := range limited {
+		section.Rows = append(section.Rows, []string{
+			pod.Namespace,
+			pod.Name,
+			fmt.Sprintf("%.1fMi", pod.RAMWorkingSet),
+			fmt.Sprintf("%.1fMi", pod.RAMLimits),
+			fmt.Sprintf("%.1f%%", pod.RAMHeadroom()*100),
+		})
+	}
+	sections = append(sections, section)
+
+	// Containers which are likely to be OOM killed
+	section = Section{
+		ID:      dc.Name + "-OOM",
+		Title:   fmt.Sprintf("Containers which will likely OOM within %.0f days or use over %.0f%% of memory limit", reporter.oom.Horizon.Hours()/24, reporter.oom.Usage*100),
+		Columns: []string{"Ns", "Pod", "Container", "Risk", "Working set", "Limits", "Growth", "OOM in", "OOM killed"},
+	}
+	for _, risk := range OOMRisks(pods, reporter.oom, reporter.source.EvalTime()) {
+		oomIn, oomKilled := "", ""
+		if risk.TimeToOOM >= 0 {
+			oomIn = fmt.Sprintf("%.1f days", risk.TimeToOOM.Hours()/24)
+		}
+		if !risk.OOMKilledAt.IsZero() {
+			oomKilled = risk.OOMKilledAt.UTC().Format("2006-01-02 15:04")
+		}
+		section.Rows = append(section.Rows, []string{
+			risk.Namespace,
+			risk.Pod,
+			risk.Container,
+			fmt.Sprintf("%.0f%%", risk.Score*100),
+			fmt.Sprintf("%.1fMi", risk.WorkingSet),
+			fmt.Sprintf("%.1fMi", risk.Limit),
+			fmt.Sprintf("%+.1fMi/day", risk.Growth),
+			oomIn,
+			oomKilled,
+		})
+	}
+	sections = append(sections, section)
+
+	// Over- and under-provisioned pods by efficiency
+	recommendations := recommendationsByWorkload(dc.recommendations)
+	for _, resource := range []string{"CPU", "RAM"} {
+		over := filterPods(pods, func(pod PodInfo) bool { return pod.Score(resource).Findings.Has(FindingOverProvisioned) })
+		under := filterPods(pods, func(pod PodInfo) bool { return pod.Score(resource).Findings.Has(FindingUnderProvisioned) })
+		if resource == "CPU" {
+			sort.Sort(PodByEfficiencyCPU(over))
+			sort.Sort(PodByEfficiencyCPUDesc(under))
+		} else {
+			sort.Sort(PodByEfficiencyRAM(over))
+			sort.Sort(PodByEfficiencyRAMDesc(under))
+		}
+		sections = append(sections,
+			efficiencySection(dc.Name+"-Over-"+resource, fmt.Sprintf("Over-provisioned pods by %s requests", resource), over, resource, recommendations),
+			efficiencySection(dc.Name+"-Under-"+resource, fmt.Sprintf("Under-provisioned pods by %s requests", resource), under, resource, recommendations))
+	}
+
+	// Right-sizing recommendations with the biggest changes
+	changed := []Recommendation{}
+	for _, recommendation := range dc.recommendations {
+		if recommendation.Changed() {
+			changed = append(changed, recommendation)
+		}
+	}
+	sort.Sort(RecommendationBySavingsDesc(changed))
+	section = Section{
+		ID:      dc.Name + "-Recommendations",
+		Title:   "Right-sizing recommendations",
+		Columns: []string{"Ns", "Workload", "Container", "CPU req", "CPU lim", "RAM req", "RAM lim"},
+	}
+	for _, recommendation := range changed {
+		section.Rows = append(section.Rows, []string{
+			recommendation.Namespace,
+			recommendation.WorkloadKind + "/" + recommendation.Workload,
+			recommendation.Container,
+			recommendation.CPURequests.Format("m"),
+			recommendation.CPULimits.Format("m"),
+			recommendation.RAMRequests.Format("Mi"),
+			recommendation.RAMLimits.Format("Mi"),
+		})
+	}
+	sections = append(sections, section)
+
+	// Idle workloads never appear in the top lists, the oldest are the first
+	// Point-in-time usage has no working set trend, so RAM is not checked
+	trend := !reporter.source.Options().PointInTime
+	section = Section{
+		ID:      dc.Name + "-Idle",
+		Title:   "Idle workloads",
+		Columns: []string{"Ns", "Workload", "Team", "Age", "Pods", "CPU", "CPU req", "RAM", "RAM req"},
+	}
+	if !trend {
+		section.Title = "Idle workloads (RAM trend is not checked)"
+	}
+	for _, workload := range IdleWorkloads(pods, reporter.idle, reporter.source.Options().Network, trend) {
+		section.Rows = append(section.Rows, []string{
+			workload.Namespace,
+			workload.WorkloadKind + "/" + workload.Workload,
+			workload.Team,
+			fmt.Sprintf("%.0f days", workload.Age(now)),
+			fmt.Sprint(workload.Pods),
+			fmt.Sprintf("%.1fm", workload.CPUUsage),
+			fmt.Sprintf("%.0fm", workload.CPURequests),
+			fmt.Sprintf("%.1fMi", workload.RAMUsage),
+			fmt.Sprintf("%.0fMi", workload.RAMRequests),
+		})
+	}
+	sections = append(sections, section)
+
+	// Monthly cost and the biggest waste
+	if reporter.pricing != nil {
+		total := totalCost(pods)
+		sections = append(sections, Section{
+			ID:      dc.Name + "-Cost",
+			Title:   "Monthly cost",
+			Columns: []string{"Requests", "Usage", "Idle"},
+			Rows: [][]string{{
+				reporter.pricing.Format(total.Requests),
+				reporter.pricing.Format(total.Usage),
+				reporter.pricing.Format(total.Idle),
+			}},
+		})
+		for _, group := range []struct {
+			name  string
+			title string
+			key   func(pod PodInfo) string
+		}{
+			{"workloads", "Workloads with the biggest waste", func(pod PodInfo) string { return workloadKey(pod.Namespace, pod.WorkloadKind, pod.Workload) }},
+			{"namespaces", "Namespaces with the biggest waste", func(pod PodInfo) string { return pod.Namespace }},
+			{"teams", "Teams with the biggest waste", func(pod PodInfo) string { return pod.Team }},
+		} {
+			section = Section{
+				ID:      dc.Name + "-Waste-" + group.name,
+				Title:   group.title,
+				Columns: []string{"Name", "Idle", "Requests", "Usage", "Pods"},
+			}
+			for _, summary := range costsBy(pods, group.key) {
+				if summary.Idle <= 0 {
+					break
+				}
+				section.Rows = append(section.Rows, []string{
+					summary.Name,
+					reporter.pricing.Format(summary.Idle),
+					reporter.pricing.Format(summary.Requests),
+					reporter.pricing.Format(summary.Usage),
+					fmt.Sprint(summary.Pods),
+				})
+			}
+			sections = append(sections, section)
+		}
+	}
+
+	// Policy violations
+	if reporter.policy != nil {
+		section = Section{
+			ID:      dc.Name + "-Policy",
+			Title:   "Policy violations",
+			Columns: []string{"Severity", "Rule", "Message", "Pods", "Workloads"},
+		}
+		for _, violation := range policyViolations(dc.pods) {
+			section.Rows = append(section.Rows, []string{
+				strings.ToUpper(violation.Severity),
+				violation.Rule,
+				violation.Message,
+				fmt.Sprint(violation.Pods),
+				strings.Join(violation.Workloads, ", "),
+			})
+		}
+		sections = append(sections, section)
+	}
+
+	// Pods with huge limits to requests ratio overcommit nodes
+	overcommitted := filterPods(pods, func(pod PodInfo) bool { return pod.LimitRequestRatio() > 1 })
+	sort.Sort(PodByLimitRequestRatioDesc(overcommitted))
+	section = Section{
+		ID:      dc.Name + "-LimitRatio",
+		Title:   "Pods by limits to requests ratio",
+		Columns: []string{"Ns", "Pod", "QoS", "CPU limits/requests", "RAM limits/requests"},
+	}
+	for _, pod := range overcommitted {
+		section.Rows = append(section.Rows, []string{
+			pod.Namespace,
+			pod.Name,
+			pod.QOSClass,
+			fmt.Sprintf("%.1f", pod.CPULimitRequestRatio()),
+			fmt.Sprintf("%.1f", pod.RAMLimitRequestRatio()),
+		})
+	}
+	sections = append(sections, section)
+
+	// BestEffort pods are evicted first, some namespaces should not have them
+	section = Section{
+		ID:      dc.Name + "-BestEffort",
+		Title:   "BestEffort pods in namespaces which should not have them",
+		Columns: []string{"Ns", "Pod", "Workload"},
+	}
+	for _, pod := range bestEffort {
+		section.Rows = append(section.Rows, []string{pod.Namespace, pod.Name, pod.WorkloadKind + "/" + pod.Workload})
+	}
+	sections = append(sections, section)
+
+	// Pods without requests or limits
+	missing := filterPods(pods, func(pod PodInfo) bool {
+		return pod.CPUScore.Findings.Has(FindingMissingRequests|FindingMissingLimits) || pod.RAMScore.Findings.Has(FindingMissingRequests|FindingMissingLimits)
+	})
+	section = Section{ID: dc.Name + "-Missing", Title: "Pods without requests or limits", Columns: []string{"Ns", "Pod", "CPU", "RAM"}}
+	for _, pod := range missing {
+		section.Rows = append(section.Rows, []string{
+			pod.Namespace,
+			pod.Name,
+			(pod.CPUScore.Findings & (FindingMissingRequests | FindingMissingLimits)).String(),
+			(pod.RAMScore.Findings & (FindingMissingRequests | FindingMissingLimits)).String(),
+		})
+	}
+	sections = append(sections, section)
+
+	// Sort by CPU throttling
+	if reporter.source.Options().Throttling {
+		throttled := filterPods(pods, func(pod PodInfo) bool { return pod.CPUThrottling > 0 && !pod.Ignored[IgnoreThrottling] })
+		sort.Sort(PodByThrottlingDesc(throttled))
+		section = Section{ID: dc.Name + "-Throttling", Title: "Most throttled pods", Columns: []string{"Ns", "Pod", "Throttled", "Limits"}}
+		for _, pod := range throttled {
+			section.Rows = append(section.Rows, []string{
+				pod.Namespace,
+				pod.Name,
+				fmt.Sprintf("%.1f%%", pod.CPUThrottling*100),
+				fmt.Sprintf("%.1fm", pod.CPULimits),
+			})
+		}
+		sections = append(sections, section)
+	}
+
+	// Sort by network traffic
+	if reporter.source.Options().Network {
+		sort.Sort(PodByNetworkDesc(pods))
+		section = Section{ID: dc.Name + "-Network", Title: "Top pods by network traffic", Columns: []string{"Ns", "Pod", "Receive", "Transmit"}}
+		for _, pod := range pods {
+			section.Rows = append(section.Rows, []string{pod.Namespace, pod.Name, formatRate(pod.NetRxRate), formatRate(pod.NetTxRate)})
+		}
+		sections = append(sections, section)
+	}
+
+	// Sort by disk IO
+	if reporter.source.Options().Disk {
+		sort.Sort(PodByDiskDesc(pods))
+		section = Section{ID: dc.Name + "-Disk", Title: "Top pods by disk IO", Columns: []string{"Ns", "Pod", "Read", "Write"}}
+		for _, pod := range pods {
+			section.Rows = append(section.Rows, []string{pod.Namespace, pod.Name, formatRate(pod.FsReadRate), formatRate(pod.FsWriteRate)})
+		}
+		sections = append(sections, section)
+	}
+	return sections
+}
+
+// efficiencySection returns pods with usage, requests, efficiency and recommended requests of the resource
+func efficiencySection(id string, title string, pods []PodInfo, resource string, recommendations map[string][]Recommendation) Section {
+	section := Section{ID: id, Title: title, Columns: []string{"Ns", "Pod", resource, "Requests", "Efficiency"}}
+	for _, pod := range pods {
+		usage, unit := pod.CPUMetric, "m"
+		requests := Change{Current: pod.CPURequsts}
+		if resource == "RAM" {
+			usage, unit = pod.RAMMetric, "Mi"
+			requests.Current = pod.RAMRequests
+		}
+		formatted := fmt.Sprintf("%.1f%s", requests.Current, unit)
+		if podRecommendations := recommendations[workloadKey(pod.Namespace, pod.WorkloadKind, pod.Workload)]; len(podRecommendations) > 0 {
+			for _, recommendation := range podRecommendations {
+				if resource == "RAM" {
+					requests.Recommended += recommendation.RAMRequests.Recommended
+				} else {
+					requests.Recommended += recommendation.CPURequests.Recommended
+				}
+			}
+			formatted = requests.Format(unit)
+		}
+		section.Rows = append(section.Rows, []string{
+			pod.Namespace,
+			pod.Name,
+			fmt.Sprintf("%.1f%s", usage, unit),
+			formatted,
+			fmt.Sprintf("%.0f%%", pod.Score(resource).Efficiency*100),
+		})
+	}
+	return section
+}
+
+// formatRate formats bytes per second
+func formatRate(rate float64) string {
+	units := []string{"B/s", "KiB/s", "MiB/s", "GiB/s"}
+	i := 0
+	for rate >= 1024 && i < len(units)-1 {
+		rate /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", rate, units[i])
+}
+
+// formatQuantile formats quantile value, empty if it is not known
+func formatQuantile(quantiles map[string]float64, phi string, unit string) string {
+	value, ok := quantiles[phi]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%.1f%s", value, unit)
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"strings"
+)
+
+// Finding
+// Classification flags of a resource, one resource can have several of them
+type Finding uint8
+
+const (
+	FindingOverProvisioned Finding = 1 << iota
+	FindingUnderProvisioned
+	FindingMissingRequests
+	FindingMissingLimits
+)
+
+var findingNames = []struct {
+	finding Finding
+	name    string
+}{
+	{FindingOverProvisioned, "over-provisioned"},
+	{FindingUnderProvisioned, "under-provisioned"},
+	{FindingMissingRequests, "missing requests"},
+	{FindingMissingLimits, "missing limits"},
+}
+
+func (finding Finding) Has(flag Finding) bool {
+	return finding&flag != 0
+}
+
+func (finding Finding) String() string {
+	names := finding.Names()
+	if len(names) == 0 {
+		return "ok"
+	}
+	return strings.Join(names, ", ")
+}
+
+// Names returns names of all flags
+func (finding Finding) Names() []string {
+	names := []string{}
+	for _, item := range findingNames {
+		if finding.Has(item.finding) {
+			names = append(names, item.name)
+		}
+	}
+	return names
+}
+
+// ScoringOptions
+// Efficiency thresholds, efficiency is usage divided by requests
+type ScoringOptions struct {
+	OverProvisioned  float64 // Efficiency below is over-provisioned
+	UnderProvisioned float64 // Efficiency above is under-provisioned
+}
+
+func DefaultScoringOptions() ScoringOptions {
+	return ScoringOptions{
+		OverProvisioned:  1.0 / 3,
+		UnderProvisioned: 1,
+	}
+}
+
+// ResourceScore
+// Efficiency and findings of one resource of a pod
+type ResourceScore struct {
+	Efficiency float64 // Usage to requests ratio, 0 when requests are missing
+	Findings   Finding
+}
+
+// ScoreResource
+// Scores usage against requests and limits. Resources without requests are never over- or under-provisioned,
+// thresholds themselves are not findings
+func ScoreResource(usage float64, requests float64, limits float64, options ScoringOptions) ResourceScore {
+	score := ResourceScore{}
+	if limits <= 0 {
+		score.Findings |= FindingMissingLimits
+	}
+	if requests <= 0 {
+		score.Findings |= FindingMissingRequests
+		return score
+	}
+	score.Efficiency = usage / requests
+	if score.Efficiency < options.OverProvisioned {
+		score.Findings |= FindingOverProvisioned
+	}
+	if score.Efficiency > options.UnderProvisioned {
+		score.Findings |= FindingUnderProvisioned
+	}
+	return score
+}
+
+// Class returns the main finding of score, which is used for counting pods
+func (score ResourceScore) Class() string {
+	switch {
+	case score.Findings.Has(FindingMissingRequests):
+		return FindingMissingRequests.String()
+	case score.Findings.Has(FindingOverProvisioned):
+		return FindingOverProvisioned.String()
+	case score.Findings.Has(FindingUnderProvisioned):
+		return FindingUnderProvisioned.String()
+	}
+	return "ok"
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestScoreResource(t *testing.T) {
+	options := ScoringOptions{OverProvisioned: 0.25, UnderProvisioned: 1}
+	tests := []struct {
+		name       string
+		usage      float64
+		requests   float64
+		limits     float64
+		efficiency float64
+		findings   Finding
+	}{
+		{"within thresholds", 50, 100, 200, 0.5, 0},
+		{"exactly at over-provisioned threshold", 25, 100, 200, 0.25, 0},
+		{"below over-provisioned threshold", 24, 100, 200, 0.24, FindingOverProvisioned},
+		{"exactly at under-provisioned threshold", 100, 100, 200, 1, 0},
+		{"above under-provisioned threshold", 101, 100, 200, 1.01, FindingUnderProvisioned},
+		{"zero requests", 50, 0, 200, 0, FindingMissingRequests},
+		{"zero limits", 50, 100, 0, 0.5, FindingMissingLimits},
+		{"zero requests and limits", 50, 0, 0, 0, FindingMissingRequests | FindingMissingLimits},
+		{"zero usage", 0, 100, 200, 0, FindingOverProvisioned},
+		{"zero usage without requests", 0, 0, 200, 0, FindingMissingRequests},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			score := ScoreResource(test.usage, test.requests, test.limits, options)
+			if score.Efficiency != test.efficiency {
+				t.Errorf("efficiency is %v, expected %v", score.Efficiency, test.efficiency)
+			}
+			if score.Findings != test.findings {
+				t.Errorf("findings are %q, expected %q", score.Findings, test.findings)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+)
+
+// Sink
+// Output of the report
+type Sink interface {
+	// Name returns name of sink for logs and errors
+	Name() string
+	// Write renders and delivers report
+	Write(ctx context.Context, report *Report) error
+}
+
+// GetReport
+// Builds report and writes it to every sink, sinks are independent and all of them are tried
+func (reporter *PodReporter) GetReport(ctx context.Context, sinks []Sink) error {
+	reporter.logger.Info("Generating report")
+	report := reporter.BuildReport()
+	errs := &errorCollector{}
+	for _, sink := range sinks {
+		reporter.logger.Infof("Writing report to %s", sink.Name())
+		if err := sink.Write(ctx, report); err != nil {
+			errs.Add(fmt.Errorf("%s: %w", sink.Name(), err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/slack-go/slack"
+	"strings"
+)
+
+// Slack does not accept messages with more blocks
+const slackMaxBlocks = 50
+
+// SlackSink
+// Sends report to slack channel, sections are truncated to the first rows
+type SlackSink struct {
+	client  *slack.Client
+	channel string
+	rows    int
+}
+
+func CreateSlackSink(client *slack.Client, channel string, rows int) *SlackSink {
+	return &SlackSink{
+		client:  client,
+		channel: channel,
+		rows:    rows,
+	}
+}
+
+func (sink *SlackSink) Name() string {
+	return "slack"
+}
+
+// Write
+// Sends report as several messages, when it does not fit in one
+func (sink *SlackSink) Write(ctx context.Context, report *Report) error {
+	for _, blocks := range splitBlocks(sink.blockGroups(report), slackMaxBlocks) {
+		_, _, _, err := sink.client.SendMessageContext(
+			ctx,
+			sink.channel,
+			slack.MsgOptionBlocks(blocks...),
+			slack.MsgOptionAsUser(true), // Add this if you want that the bot would post message as a user, otherwise it will send response using the default slackbot
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockGroups returns blocks of header, every datacenter and appendix
+func (sink *SlackSink) blockGroups(report *Report) [][]slack.Block {
+	header := []slack.Block{
+		slack.NewHeaderBlock(&slack.TextBlockObject{
+			Type: "plain_text",
+			Text: fmt.Sprintf(":newspaper: %s :newspaper:", report.Title)}),
+	}
+
+	curTimeLine := fmt.Sprintf("*%s* | Dops team | Data as of %s, %s", report.GeneratedAt.Format("01-02-2006"), report.EvalTime.UTC().Format("2006-01-02 15:04 MST"), report.UsageNote())
+	header = append(header, slack.NewContextBlock("HeadLine", slack.MixedElement(slack.TextBlockObject{
+		Type: "mrkdwn",
+		Text: curTimeLine,
+	})))
+	if report.Partial() {
+		header = append(header, slack.NewContextBlock("Partial", slack.MixedElement(slack.TextBlockObject{
+			Type: "mrkdwn",
+			Text: fmt.Sprintf(":warning: Partial report, metrics were received for %d of %d pods", report.Processed, report.Total),
+		})))
+	}
+	header = append(header, slack.NewDividerBlock())
+	groups := [][]slack.Block{header}
+
+	for _, dc := range report.Datacenters {
+		summary := dc.Summary
+		// Allocatable is unknown if nodes cannot be listed
+		overcommit := ""
+		if summary.AllocatableCPU > 0 || summary.AllocatableRAM > 0 {
+			overcommit = fmt.Sprintf("*Limits to allocatable:* CPU %.0f%%, RAM %.0f%%\t", summary.CPUOvercommit()*100, summary.RAMOvercommit()*100)
+		}
+		blocks := []slack.Block{
+			slack.NewSectionBlock(
+				&slack.TextBlockObject{
+					Type: slack.MarkdownType,
+					Text: fmt.Sprintf(":office: *Datacenter:* %s", strings.ToUpper(dc.Name)),
+				}, nil, nil),
+			slack.NewContextBlock(dc.Name+"-Summary", slack.MixedElement(slack.TextBlockObject{
+				Type: "mrkdwn",
+				Text: fmt.Sprintf("*Pods:* %d (%d with metrics)\t*Without requests:* %d\t*Without limits:* %d\n"+
+					"*CPU:* used %.0fm of %.0fm requested (%.1f%%) and %.0fm limited (%.1f%%)\n"+
+					"*RAM:* used %.0fMi of %.0fMi requested (%.1f%%) and %.0fMi limited (%.1f%%)\n"+
+					"%s*QoS:* %s\n"+
+					"*CPU pods:* %s\n*RAM pods:* %s",
+					summary.Pods, summary.ProcessedPods, summary.WithoutRequests, summary.WithoutLimits,
+					summary.CPUUsage, summary.CPURequests, summary.CPURequestsUtilisation()*100, summary.CPULimits, summary.CPULimitsUtilisation()*100,
+					summary.RAMUsage, summary.RAMRequests, summary.RAMRequestsUtilisation()*100, summary.RAMLimits, summary.RAMLimitsUtilisation()*100,
+					overcommit, formatClasses(summary.QOSClasses),
+					formatClasses(summary.CPUClasses), formatClasses(summary.RAMClasses)),
+			})),
+		}
+		for _, section := range dc.Sections {
+			blocks = append(blocks, sink.sectionBlocks(section)...)
+		}
+		blocks = append(blocks, slack.NewDividerBlock())
+		groups = append(groups, blocks)
+	}
+
+	var appendix []slack.Block
+	for _, section := range report.Appendix {
+		appendix = append(appendix, sink.sectionBlocks(section)...)
+	}
+	if len(appendix) > 0 {
+		groups = append(groups, appendix)
+	}
+	return groups
+}
+
+// sectionBlocks returns title and the first rows of section
+func (sink *SlackSink) sectionBlocks(section Section) []slack.Block {
+	title := fmt.Sprintf("*%s*", section.Title)
+	if len(section.Rows) > sink.rows {
+		title += fmt.Sprintf(" (top %d of %d)", sink.rows, len(section.Rows))
+	}
+	podString := ""
+	for i := 0; i < sink.rows && i < len(section.Rows); i++ {
+		var cells []string
+		for j, value := range section.Rows[i] {
+			if value == "" {
+				continue
+			}
+			cells = append(cells, fmt.Sprintf("*%s:* %s", section.Columns[j], value))
+		}
+		podString += strings.Join(cells, "\t") + "\n"
+	}
+	return podsSection(section.ID, title, podString)
+}
+
+// podsSection returns title and pods list blocks
+func podsSection(blockID string, title string, podString string) []slack.Block {
+	if podString == "" {
+		podString = "No pods found"
+	}
+	return []slack.Block{
+		slack.NewSectionBlock(
+			&slack.TextBlockObject{
+				Type: slack.MarkdownType,
+				Text: title,
+			}, nil, nil),
+		slack.NewContextBlock(blockID, slack.MixedElement(slack.TextBlockObject{
+			Type: "mrkdwn",
+			Text: podString,
+		})),
+	}
+}
+
+// splitBlocks packs groups of blocks into messages, groups which are too big are split
+func splitBlocks(groups [][]slack.Block, limit int) [][]slack.Block {
+	var messages [][]slack.Block
+	var current []slack.Block
+	for _, group := range groups {
+		if len(current)+len(group) > limit && len(current) > 0 {
+			messages = append(messages, current)
+			current = nil
+		}
+		for len(group) > limit {
+			messages = append(messages, group[:limit])
+			group = group[limit:]
+		}
+		current = append(current, group...)
+	}
+	if len(current) > 0 {
+		messages = append(messages, current)
+	}
+	return messages
+}
@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rows of every section in plain-text and HTML parts, attachment contains all rows
+const smtpTextRows = 10
+
+// Email clients do not run scripts and drop styles, so email has its own static template with inline styles
+var emailTemplate = template.Must(template.ParseFS(htmlFiles, "templates/email.html"))
+
+// emailPage
+// Data of email HTML template
+type emailPage struct {
+	Title       string
+	GeneratedAt time.Time
+	EvalTime    time.Time
+	UsageNote   string
+	Partial     bool
+	Processed   int
+	Total       int
+	Datacenters []emailDatacenter
+	Appendix    []emailSection
+}
+
+type emailDatacenter struct {
+	Name     string
+	Cards    []htmlCard
+	Sections []emailSection
+}
+
+type emailSection struct {
+	Title   string
+	Columns []string
+	Rows    [][]string
+}
+
+// SMTPOptions
+// Mail server and recipients of email report
+type SMTPOptions struct {
+	Address            string // host:port
+	Username           string // Empty - authentication is disabled
+	Password           string
+	StartTLS           bool
+	InsecureSkipVerify bool // Do not verify server certificate, for local servers only
+	From               string
+	To                 []string            // Recipients of the whole report
+	TeamRecipients     map[string][]string // Recipients of team reports
+}
+
+// SMTPSink
+// Sends report as multipart HTML and plain-text email with CSV attachment
+type SMTPSink struct {
+	options SMTPOptions
+}
+
+func CreateSMTPSink(options SMTPOptions) *SMTPSink {
+	return &SMTPSink{options: options}
+}
+
+func (sink *SMTPSink) Name() string {
+	return "smtp"
+}
+
+// Write
+// Sends the whole report to recipients and report of every team to its recipients, teams without pods are skipped
+func (sink *SMTPSink) Write(ctx context.Context, report *Report) error {
+	errs := &errorCollector{}
+	if len(sink.options.To) > 0 {
+		if err := sink.sendReport(ctx, sink.options.To, report); err != nil {
+			errs.Add(err)
+		}
+	}
+
+	var teams []string
+	for team := range sink.options.TeamRecipients {
+		teams = append(teams, team)
+	}
+	sort.Strings(teams)
+	for _, team := range teams {
+		teamReport := report.ForTeam(team)
+		if len(teamReport.Datacenters) == 0 {
+			continue
+		}
+		if err := sink.sendReport(ctx, sink.options.TeamRecipients[team], teamReport); err != nil {
+			errs.Add(fmt.Errorf("team %s: %w", team, err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+func (sink *SMTPSink) sendReport(ctx context.Context, to []string, report *Report) error {
+	message, err := BuildEmail(sink.options.From, to, report)
+	if err != nil {
+		return err
+	}
+	return sink.send(ctx, to, message)
+}
+
+// send delivers message, connection is closed when context is done
+func (sink *SMTPSink) send(ctx context.Context, to []string, message []byte) error {
+	host, _, err := net.SplitHostPort(sink.options.Address)
+	if err != nil {
+		return fmt.Errorf("invalid smtp address %s: %w", sink.options.Address, err)
+	}
+	from, err := mail.ParseAddress(sink.options.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %s: %w", sink.options.From, err)
+	}
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", sink.options.Address)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if sink.options.StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: host, InsecureSkipVerify: sink.options.InsecureSkipVerify}); err != nil {
+			return err
+		}
+	}
+	if sink.options.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", sink.options.Username, sink.options.Password, host)); err != nil {
+			return fmt.Errorf("smtp authentication failed: %w", err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %s: %w", recipient, err)
+		}
+		if err := client.Rcpt(address.Address); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// BuildEmail
+// Builds MIME message with HTML and plain-text alternatives and CSV attachment of the report
+func BuildEmail(from string, to []string, report *Report) ([]byte, error) {
+	var html, text, attachment bytes.Buffer
+	if err := RenderEmailHTML(&html, report, smtpTextRows); err != nil {
+		return nil, err
+	}
+	if err := RenderMarkdown(&text, report, smtpTextRows); err != nil {
+		return nil, err
+	}
+	if err := writeCSV(csv.NewWriter(&attachment), ExportReport(report)); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	mixed := multipart.NewWriter(&message)
+	date := report.GeneratedAt.Format("2006-01-02")
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", fmt.Sprintf("%s %s", report.Title, date)))
+	fmt.Fprintf(&message, "Date: %s\r\n", report.GeneratedAt.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mixed.Boundary())
+
+	// Clients show the last alternative they support
+	alternativePart := &bytes.Buffer{}
+	alternative := multipart.NewWriter(alternativePart)
+	for _, body := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		part, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {body.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(part)
+		if _, err := encoder.Write(body.content); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := alternative.Close(); err != nil {
+		return nil, err
+	}
+	part, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {fmt.Sprintf("multipart/alternative; boundary=%q", alternative.Boundary())},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(alternativePart.Bytes()); err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("podreporter-%s.csv", date)
+	part, err = mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {fmt.Sprintf("text/csv; charset=utf-8; name=%q", name)},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", name)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBase64Lines(part, attachment.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return message.Bytes(), nil
+}
+
+// RenderEmailHTML
+// Renders report as static HTML for email clients, sections are truncated to rows, 0 - all rows
+func RenderEmailHTML(writer io.Writer, report *Report, rows int) error {
+	page := emailPage{
+		Title:       report.Title,
+		GeneratedAt: report.GeneratedAt,
+		EvalTime:    report.EvalTime,
+		UsageNote:   report.UsageNote(),
+		Partial:     report.Partial(),
+		Processed:   report.Processed,
+		Total:       report.Total,
+	}
+	document := ExportReport(report)
+	for _, dc := range report.Datacenters {
+		datacenter := emailDatacenter{
+			Name:  strings.ToUpper(dc.Name),
+			Cards: htmlCards(dc.Summary, datacenterPods(document.Pods, dc.Name), report.Currency),
+		}
+		for _, section := range dc.Sections {
+			datacenter.Sections = append(datacenter.Sections, emailSectionOf(section, rows))
+		}
+		page.Datacenters = append(page.Datacenters, datacenter)
+	}
+	for _, section := range report.Appendix {
+		page.Appendix = append(page.Appendix, emailSectionOf(section, rows))
+	}
+	if err := emailTemplate.Execute(writer, page); err != nil {
+		return fmt.Errorf("cannot render email: %w", err)
+	}
+	return nil
+}
+
+func emailSectionOf(section Section, rows int) emailSection {
+	title, sectionRows := truncateSection(section, rows)
+	return emailSection{Title: title, Columns: section.Columns, Rows: sectionRows}
+}
+
+// writeBase64Lines writes base64 encoded data in lines of 76 characters, as required by MIME
+func writeBase64Lines(writer io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		line := encoded
+		if len(line) > 76 {
+			line = line[:76]
+		}
+		encoded = encoded[len(line):]
+		if _, err := io.WriteString(writer, line+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseRecipients
+// Parses recipients of teams in format team=address,address;team=address
+func ParseRecipients(value string) (map[string][]string, error) {
+	recipients := map[string][]string{}
+	for _, item := range strings.Split(value, ";") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		team := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || team == "" {
+			return nil, fmt.Errorf("invalid team recipients %q, team=address,address is expected", item)
+		}
+		for _, address := range strings.Split(parts[1], ",") {
+			address = strings.TrimSpace(address)
+			if _, err := mail.ParseAddress(address); err != nil {
+				return nil, fmt.Errorf("invalid recipient %q of team %s: %w", address, team, err)
+			}
+			recipients[team] = append(recipients[team], address)
+		}
+	}
+	return recipients, nil
+}
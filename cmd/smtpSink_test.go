@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMessage
+// Envelope and data received by fake SMTP server
+type fakeMessage struct {
+	from       string
+	recipients []string
+	data       []byte
+}
+
+// fakeSMTPServer
+// Accepts connections and answers the minimal SMTP exchange of net/smtp client without STARTTLS and authentication
+type fakeSMTPServer struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	messages []fakeMessage
+	wait     sync.WaitGroup
+}
+
+func startFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	server := &fakeSMTPServer{listener: listener}
+	server.wait.Add(1)
+	go func() {
+		defer server.wait.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *fakeSMTPServer) Close() {
+	server.listener.Close()
+	server.wait.Wait()
+}
+
+func (server *fakeSMTPServer) Messages() []fakeMessage {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]fakeMessage{}, server.messages...)
+}
+
+func (server *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+	message := fakeMessage{}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 localhost")
+		case "MAIL":
+			message.from = fakeAddress(line)
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			message.recipients = append(message.recipients, fakeAddress(line))
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.data = data
+			server.mutex.Lock()
+			server.messages = append(server.messages, message)
+			server.mutex.Unlock()
+			message = fakeMessage{}
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// fakeAddress returns address between angle brackets of MAIL and RCPT commands
+func fakeAddress(line string) string {
+	start, end := strings.Index(line, "<"), strings.LastIndex(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
+
+// testSections returns section of datacenter pods, padded to more rows than email shows
+func testSections(dc Datacenter, now time.Time) []Section {
+	section := Section{ID: dc.Name + "-Top", Title: "Top CPU pods", Columns: []string{"Ns", "Pod"}}
+	for _, pod := range dc.pods {
+		section.Rows = append(section.Rows, []string{pod.Namespace, pod.Name})
+	}
+	for i := 0; i < smtpTextRows+5-len(dc.pods); i++ {
+		section.Rows = append(section.Rows, []string{"default", fmt.Sprintf("pod-%02d", i)})
+	}
+	return []Section{section}
+}
+
+func testEmailReport() *Report {
+	pods := []PodInfo{
+		{Name: "api-1", Namespace: "default", WorkloadKind: "Deployment", Workload: "api", Team: "payments", Processed: true},
+		{Name: "worker-1", Namespace: "default", WorkloadKind: "Deployment", Workload: "worker", Processed: true},
+	}
+	dc := Datacenter{Name: "dc1", pods: pods}
+	return &Report{
+		Title:       "Pod report",
+		GeneratedAt: time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC),
+		EvalTime:    time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC),
+		Processed:   2,
+		Total:       2,
+		Datacenters: []DatacenterReport{{
+			Name:     "dc1",
+			Summary:  Summarize(pods),
+			Sections: testSections(dc, time.Time{}),
+			Pods:     pods,
+		}},
+		sections: testSections,
+	}
+}
+
+func TestSMTPSinkWrite(t *testing.T) {
+	server := startFakeSMTPServer(t)
+	defer server.Close()
+
+	sink := CreateSMTPSink(SMTPOptions{
+		Address: server.listener.Addr().String(),
+		From:    "Pod reporter <reporter@example.com>",
+		To:      []string{"ops@example.com", "Lead <lead@example.com>"},
+		TeamRecipients: map[string][]string{
+			"payments": {"payments@example.com"},
+			"search":   {"search@example.com"}, // Team without pods
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := sink.Write(ctx, testEmailReport()); err != nil {
+		t.Fatalf("cannot send report: %v", err)
+	}
+
+	messages := server.Messages()
+	expected := []struct {
+		recipients []string
+		pods       []string // Pods in sections
+		otherPods  []string // Pods of other teams, they must not be in sections
+	}{
+		{[]string{"ops@example.com", "lead@example.com"}, []string{"api-1", "worker-1"}, nil},
+		{[]string{"payments@example.com"}, []string{"api-1"}, []string{"worker-1"}},
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("%d messages are sent, expected %d", len(messages), len(expected))
+	}
+	for i, message := range messages {
+		if message.from != "reporter@example.com" {
+			t.Errorf("message %d is sent from %q", i, message.from)
+		}
+		if strings.Join(message.recipients, ",") != strings.Join(expected[i].recipients, ",") {
+			t.Errorf("message %d is sent to %v, expected %v", i, message.recipients, expected[i].recipients)
+		}
+		html := checkEmail(t, message.data)
+		if !strings.Contains(html, "Top CPU pods") || !strings.Contains(html, fmt.Sprintf("top %d of %d", smtpTextRows, smtpTextRows+5)) {
+			t.Errorf("message %d has no truncated sections", i)
+		}
+		for _, pod := range expected[i].pods {
+			if !strings.Contains(html, pod) {
+				t.Errorf("message %d has no pod %s in sections", i, pod)
+			}
+		}
+		for _, pod := range expected[i].otherPods {
+			if strings.Contains(html, pod) {
+				t.Errorf("message %d has pod %s of other team", i, pod)
+			}
+		}
+	}
+}
+
+// checkEmail checks that message is multipart/mixed of HTML and plain-text alternatives and CSV attachment,
+// returns HTML part
+func checkEmail(t *testing.T, data []byte) string {
+	t.Helper()
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("cannot parse message: %v", err)
+	}
+	mixed := multipartParts(t, message.Header.Get("Content-Type"), message.Body, "multipart/mixed")
+	if len(mixed) != 2 {
+		t.Fatalf("multipart/mixed has %d parts, expected 2", len(mixed))
+	}
+
+	alternative := multipartParts(t, mixed[0].header.Get("Content-Type"), bytes.NewReader(mixed[0].body), "multipart/alternative")
+	if len(alternative) != 2 {
+		t.Fatalf("multipart/alternative has %d parts, expected 2", len(alternative))
+	}
+	for i, contentType := range []string{"text/plain", "text/html"} {
+		mediaType, _, _ := mime.ParseMediaType(alternative[i].header.Get("Content-Type"))
+		if mediaType != contentType {
+			t.Errorf("alternative %d is %s, expected %s", i, mediaType, contentType)
+		}
+	}
+	html := string(alternative[1].body)
+	for _, forbidden := range []string{"<script", "data-tab", "pod-12"} {
+		if strings.Contains(html, forbidden) {
+			t.Errorf("html part contains %q", forbidden)
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(mixed[1].header.Get("Content-Type"))
+	disposition, params, _ := mime.ParseMediaType(mixed[1].header.Get("Content-Disposition"))
+	if mediaType != "text/csv" || disposition != "attachment" || !strings.HasSuffix(params["filename"], ".csv") {
+		t.Errorf("attachment is %s, %s %v", mediaType, disposition, params)
+	}
+	records, err := csv.NewReader(bytes.NewReader(mixed[1].body)).ReadAll()
+	if err != nil || len(records) == 0 || strings.Join(records[0], ",") != strings.Join(csvColumns, ",") {
+		t.Errorf("attachment is not report CSV: %v", err)
+	}
+	return html
+}
+
+type mimePart struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// multipartParts returns decoded parts of multipart body of expected media type
+func multipartParts(t *testing.T, contentType string, body io.Reader, expected string) []mimePart {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != expected {
+		t.Fatalf("content type is %q, expected %s", contentType, expected)
+	}
+	reader := multipart.NewReader(body, params["boundary"])
+	var parts []mimePart
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatalf("cannot read %s part: %v", expected, err)
+		}
+		var content io.Reader = part
+		if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+			content = base64.NewDecoder(base64.StdEncoding, part)
+		}
+		data, err := ioutil.ReadAll(content)
+		if err != nil {
+			t.Fatalf("cannot read %s part: %v", expected, err)
+		}
+		parts = append(parts, mimePart{header: part.Header, body: data})
+	}
+}
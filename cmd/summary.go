@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Summary
+// Totals of a datacenter, usage and utilisation are calculated for pods with metrics only.
+// CPU values are in millicores, RAM values are in Mi
+type Summary struct {
+	Pods            int            `json:"pods"`
+	ProcessedPods   int            `json:"processedPods"`
+	CPURequests     float64        `json:"cpuRequests"`
+	CPULimits       float64        `json:"cpuLimits"`
+	CPUUsage        float64        `json:"cpuUsage"`
+	RAMRequests     float64        `json:"memoryRequests"`
+	RAMLimits       float64        `json:"memoryLimits"`
+	RAMUsage        float64        `json:"memoryUsage"`
+	WithoutRequests int            `json:"withoutRequests"` // Pods without CPU or memory requests
+	WithoutLimits   int            `json:"withoutLimits"`   // Pods without CPU or memory limits
+	CPUClasses      map[string]int `json:"cpuClasses"`      // Pods by score class
+	RAMClasses      map[string]int `json:"memoryClasses"`
+	QOSClasses      map[string]int `json:"qosClasses"`
+
+	// Overcommit of all pods, including pods without metrics
+	AllocatableCPU   float64 `json:"allocatableCPU"`
+	AllocatableRAM   float64 `json:"allocatableMemory"`
+	TotalCPURequests float64 `json:"totalCPURequests"`
+	TotalCPULimits   float64 `json:"totalCPULimits"`
+	TotalRAMRequests float64 `json:"totalMemoryRequests"`
+	TotalRAMLimits   float64 `json:"totalMemoryLimits"`
+}
+
+// Summarize
+// Calculates summary of pods
+func Summarize(pods []PodInfo) Summary {
+	summary := Summary{
+		Pods:       len(pods),
+		CPUClasses: map[string]int{},
+		RAMClasses: map[string]int{},
+		QOSClasses: map[string]int{},
+	}
+	for _, pod := range pods {
+		summary.QOSClasses[pod.QOSClass]++
+		summary.TotalCPURequests += pod.CPURequsts
+		summary.TotalCPULimits += pod.CPULimits
+		summary.TotalRAMRequests += pod.RAMRequests
+		summary.TotalRAMLimits += pod.RAMLimits
+		if pod.CPURequsts == 0 || pod.RAMRequests == 0 {
+			summary.WithoutRequests++
+		}
+		if pod.CPULimits == 0 || pod.RAMLimits == 0 {
+			summary.WithoutLimits++
+		}
+		if !pod.Processed {
+			continue
+		}
+		summary.ProcessedPods++
+		summary.CPURequests += pod.CPURequsts
+		summary.CPULimits += pod.CPULimits
+		summary.CPUUsage += pod.CPUMetric
+		summary.RAMRequests += pod.RAMRequests
+		summary.RAMLimits += pod.RAMLimits
+		summary.RAMUsage += pod.RAMMetric
+		summary.CPUClasses[pod.CPUScore.Class()]++
+		summary.RAMClasses[pod.RAMScore.Class()]++
+	}
+	return summary
+}
+
+// Summary returns summary of datacenter pods
+func (dc *Datacenter) Summary() Summary {
+	summary := Summarize(dc.pods)
+	summary.AllocatableCPU = dc.allocatableCPU
+	summary.AllocatableRAM = dc.allocatableRAM
+	return summary
+}
+
+// CPURequestsUtilisation returns usage to requests ratio, 0 if there are no requests
+func (summary *Summary) CPURequestsUtilisation() float64 {
+	return ratio(summary.CPUUsage, summary.CPURequests)
+}
+
+func (summary *Summary) CPULimitsUtilisation() float64 {
+	return ratio(summary.CPUUsage, summary.CPULimits)
+}
+
+func (summary *Summary) RAMRequestsUtilisation() float64 {
+	return ratio(summary.RAMUsage, summary.RAMRequests)
+}
+
+func (summary *Summary) RAMLimitsUtilisation() float64 {
+	return ratio(summary.RAMUsage, summary.RAMLimits)
+}
+
+// CPUOvercommit returns limits of all pods to allocatable ratio, above 1 nodes are overcommitted
+func (summary *Summary) CPUOvercommit() float64 {
+	return ratio(summary.TotalCPULimits, summary.AllocatableCPU)
+}
+
+func (summary *Summary) RAMOvercommit() float64 {
+	return ratio(summary.TotalRAMLimits, summary.AllocatableRAM)
+}
+
+// formatClasses formats pods by class like "ok: 10, over-provisioned: 3"
+func formatClasses(classes map[string]int) string {
+	var names []string
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s: %d", name, classes[name]))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Annotations which suppress findings, they can be set on pods, workloads and namespaces
+const (
+	AnnotationIgnore       = "podreporter.io/ignore"        // Comma separated findings, like "cpu-requests,memory"
+	AnnotationIgnoreUntil  = "podreporter.io/ignore-until"  // Optional expiry, 2006-01-02 or RFC3339
+	AnnotationIgnoreReason = "podreporter.io/ignore-reason" // Optional reason, shown in the report
+)
+
+// Findings which can be suppressed
+const (
+	IgnoreCPURequests    = "cpu-requests"    // Over-, under-provisioned and missing CPU requests
+	IgnoreCPULimits      = "cpu-limits"      // Missing CPU limits
+	IgnoreMemoryRequests = "memory-requests" // Over-, under-provisioned and missing memory requests
+	IgnoreMemoryLimits   = "memory-limits"   // Missing memory limits
+	IgnoreThrottling     = "throttling"
+	IgnorePolicy         = "policy"
+	IgnoreIdle           = "idle" // Idle workloads, like failover standbys
+)
+
+// Shortcuts for several findings
+var ignoreGroups = map[string][]string{
+	IgnoreCPURequests:    {IgnoreCPURequests},
+	IgnoreCPULimits:      {IgnoreCPULimits},
+	IgnoreMemoryRequests: {IgnoreMemoryRequests},
+	IgnoreMemoryLimits:   {IgnoreMemoryLimits},
+	IgnoreThrottling:     {IgnoreThrottling},
+	IgnorePolicy:         {IgnorePolicy},
+	IgnoreIdle:           {IgnoreIdle},
+	"cpu":                {IgnoreCPURequests, IgnoreCPULimits, IgnoreThrottling},
+	"memory":             {IgnoreMemoryRequests, IgnoreMemoryLimits},
+	"all":                {IgnoreCPURequests, IgnoreCPULimits, IgnoreMemoryRequests, IgnoreMemoryLimits, IgnoreThrottling, IgnorePolicy, IgnoreIdle},
+}
+
+// Suppression
+// Findings suppressed by annotations of a pod, workload or namespace
+type Suppression struct {
+	Kind      string // Namespace, Pod or workload kind
+	Namespace string
+	Name      string
+	Findings  []string
+	Until     time.Time // Zero if suppression never expires
+	Reason    string
+	Problem   string // Expiry cannot be parsed, suppression is treated as expired
+}
+
+// ParseSuppression
+// Reads suppression from annotations. Unknown findings are skipped and reported in error, so suppression is still usable.
+// Broken expiry is reported too, but such suppression is never applied, as it would otherwise suppress forever
+func ParseSuppression(kind string, namespace string, name string, annotations map[string]string) (*Suppression, error) {
+	value, ok := annotations[AnnotationIgnore]
+	if !ok {
+		return nil, nil
+	}
+	suppression := Suppression{
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Reason:    annotations[AnnotationIgnoreReason],
+	}
+	var problems []string
+	seen := map[string]bool{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		group, ok := ignoreGroups[item]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown finding %q", item))
+			continue
+		}
+		for _, finding := range group {
+			if !seen[finding] {
+				seen[finding] = true
+				suppression.Findings = append(suppression.Findings, finding)
+			}
+		}
+	}
+	sort.Strings(suppression.Findings)
+
+	if until := strings.TrimSpace(annotations[AnnotationIgnoreUntil]); until != "" {
+		parsed, err := parseUntil(until)
+		if err != nil {
+			problems = append(problems, err.Error())
+			suppression.Problem = err.Error()
+		}
+		suppression.Until = parsed
+	}
+
+	if len(problems) > 0 {
+		return &suppression, fmt.Errorf("%s %s/%s: %s", kind, namespace, name, strings.Join(problems, ", "))
+	}
+	return &suppression, nil
+}
+
+// parseUntil parses expiry, date means the last second of that day in UTC
+func parseUntil(value string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot parse expiry %q, use 2006-01-02 or RFC3339", value)
+	}
+	return parsed.AddDate(0, 0, 1).Add(-time.Second), nil
+}
+
+// Expired returns true, if suppression has expiry in the past or expiry cannot be parsed
+func (suppression *Suppression) Expired(now time.Time) bool {
+	if suppression.Problem != "" {
+		return true
+	}
+	return !suppression.Until.IsZero() && now.After(suppression.Until)
+}
+
+// ApplySuppressions
+// Removes findings suppressed by active suppressions of the pod, must be called after scoring and policy evaluation
+func (pod *PodInfo) ApplySuppressions(now time.Time) {
+	pod.Ignored = map[string]bool{}
+	for _, suppression := range pod.Suppressions {
+		if suppression.Expired(now) {
+			continue
+		}
+		for _, finding := range suppression.Findings {
+			pod.Ignored[finding] = true
+		}
+	}
+	if pod.Ignored[IgnoreCPURequests] {
+		pod.CPUScore.Findings &^= FindingOverProvisioned | FindingUnderProvisioned | FindingMissingRequests
+	}
+	if pod.Ignored[IgnoreCPULimits] {
+		pod.CPUScore.Findings &^= FindingMissingLimits
+	}
+	if pod.Ignored[IgnoreMemoryRequests] {
+		pod.RAMScore.Findings &^= FindingOverProvisioned | FindingUnderProvisioned | FindingMissingRequests
+	}
+	if pod.Ignored[IgnoreMemoryLimits] {
+		pod.RAMScore.Findings &^= FindingMissingLimits
+	}
+	if pod.Ignored[IgnorePolicy] {
+		pod.PolicyFindings = nil
+	}
+}
+
+// ActiveSuppression
+// Suppression with amount of affected pods
+type ActiveSuppression struct {
+	Suppression
+	Pods    int
+	Expired bool // Expiry is in the past, annotation should be removed
+}
+
+// activeSuppressions returns suppressions of pods without duplicates, expired ones are the first
+func activeSuppressions(pods []PodInfo, now time.Time) []ActiveSuppression {
+	var suppressions []ActiveSuppression
+	index := map[string]int{}
+	for _, pod := range pods {
+		for _, suppression := range pod.Suppressions {
+			key := strings.Join([]string{suppression.Kind, suppression.Namespace, suppression.Name}, "/")
+			i, ok := index[key]
+			if !ok {
+				suppressions = append(suppressions, ActiveSuppression{
+					Suppression: suppression,
+					Expired:     suppression.Expired(now),
+				})
+				i = len(suppressions) - 1
+				index[key] = i
+			}
+			suppressions[i].Pods++
+		}
+	}
+	sort.SliceStable(suppressions, func(i, j int) bool {
+		if suppressions[i].Expired != suppressions[j].Expired {
+			return suppressions[i].Expired
+		}
+		if suppressions[i].Namespace != suppressions[j].Namespace {
+			return suppressions[i].Namespace < suppressions[j].Namespace
+		}
+		return suppressions[i].Kind+"/"+suppressions[i].Name < suppressions[j].Kind+"/"+suppressions[j].Name
+	})
+	return suppressions
+}
+
+// Object returns suppressed object like "default/Deployment/api" or "Namespace/default"
+func (suppression *Suppression) Object() string {
+	if suppression.Kind == "Namespace" {
+		return "Namespace/" + suppression.Namespace
+	}
+	return fmt.Sprintf("%s/%s/%s", suppression.Namespace, suppression.Kind, suppression.Name)
+}
+
+// Expiry formats expiry like "until 2024-01-31", "expired 2024-01-31", "no expiry" or the problem of expiry
+func (suppression *ActiveSuppression) Expiry() string {
+	switch {
+	case suppression.Problem != "":
+		return "not applied: " + suppression.Problem
+	case suppression.Expired:
+		return "expired " + suppression.Until.UTC().Format("2006-01-02")
+	case suppression.Until.IsZero():
+		return "no expiry"
+	}
+	return "until " + suppression.Until.UTC().Format("2006-01-02")
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSuppressionExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		until   string
+		err     bool
+		expired bool
+		expiry  string
+	}{
+		{"no expiry", "", false, false, "no expiry"},
+		{"date in the future", "2024-01-31", false, false, "until 2024-01-31"},
+		{"today is not expired", "2024-01-15", false, false, "until 2024-01-15"},
+		{"date in the past", "2024-01-14", false, true, "expired 2024-01-14"},
+		{"RFC3339 in the future", "2024-01-15T13:00:00Z", false, false, "until 2024-01-15"},
+		{"typo in expiry", "2024-13-01", true, true, "not applied: cannot parse expiry"},
+		{"free text expiry", "next week", true, true, "not applied: cannot parse expiry"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			annotations := map[string]string{AnnotationIgnore: "cpu"}
+			if test.until != "" {
+				annotations[AnnotationIgnoreUntil] = test.until
+			}
+			suppression, err := ParseSuppression("Deployment", "default", "api", annotations)
+			if (err != nil) != test.err {
+				t.Fatalf("error is %v, expected error: %v", err, test.err)
+			}
+			if suppression == nil {
+				t.Fatal("suppression is nil")
+			}
+			if suppression.Expired(now) != test.expired {
+				t.Errorf("expired is %v, expected %v", suppression.Expired(now), test.expired)
+			}
+
+			active := activeSuppressions([]PodInfo{{Suppressions: []Suppression{*suppression}}}, now)
+			if len(active) != 1 {
+				t.Fatalf("%d suppressions are listed, expected 1", len(active))
+			}
+			if expiry := active[0].Expiry(); !strings.HasPrefix(expiry, test.expiry) {
+				t.Errorf("expiry is %q, expected %q", expiry, test.expiry)
+			}
+
+			pod := PodInfo{
+				CPUScore:     ResourceScore{Findings: FindingOverProvisioned | FindingMissingLimits},
+				Suppressions: []Suppression{*suppression},
+			}
+			pod.ApplySuppressions(now)
+			if applied := pod.CPUScore.Findings == 0; applied == test.expired {
+				t.Errorf("suppression applied is %v, expected %v", applied, !test.expired)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+(function () {
+  // Tabs of datacenters
+  var buttons = document.querySelectorAll("nav.tabs button");
+  buttons.forEach(function (button) {
+    button.addEventListener("click", function () {
+      buttons.forEach(function (other) {
+        other.classList.toggle("active", other === button);
+      });
+      document.querySelectorAll(".tab").forEach(function (tab) {
+        tab.classList.toggle("active", tab.id === button.dataset.tab);
+      });
+    });
+  });
+
+  // Cells are compared by data-value if it is set, numbers are compared as numbers
+  function cellValue(row, column) {
+    var cell = row.cells[column];
+    if (!cell) {
+      return "";
+    }
+    return cell.dataset.value !== undefined ? cell.dataset.value : cell.textContent.trim();
+  }
+
+  function compare(a, b) {
+    var x = parseFloat(a), y = parseFloat(b);
+    if (!isNaN(x) && !isNaN(y) && x !== y) {
+      return x - y;
+    }
+    return a.localeCompare(b, undefined, {numeric: true});
+  }
+
+  document.querySelectorAll("table.sortable").forEach(function (table) {
+    var headers = table.querySelectorAll("th");
+    headers.forEach(function (header, column) {
+      header.addEventListener("click", function () {
+        var descending = !header.classList.contains("desc");
+        headers.forEach(function (other) {
+          other.classList.remove("asc", "desc");
+        });
+        header.classList.add(descending ? "desc" : "asc");
+        var body = table.tBodies[0];
+        var rows = Array.prototype.slice.call(body.rows);
+        rows.sort(function (a, b) {
+          var result = compare(cellValue(a, column), cellValue(b, column));
+          return descending ? -result : result;
+        });
+        rows.forEach(function (row) {
+          body.appendChild(row);
+        });
+      });
+    });
+  });
+
+  // Rows are shown if any cell contains all words of the filter
+  document.querySelectorAll("input.filter").forEach(function (input) {
+    var table = document.getElementById(input.dataset.table);
+    input.addEventListener("input", function () {
+      var words = input.value.toLowerCase().split(/\s+/).filter(Boolean);
+      Array.prototype.forEach.call(table.tBodies[0].rows, function (row) {
+        var text = row.textContent.toLowerCase();
+        row.hidden = !words.every(function (word) {
+          return text.indexOf(word) >= 0;
+        });
+      });
+    });
+  });
+})();
@@ -1,16 +1,20 @@
 module github.com/serge-r/podreporter
 
-go 1.15
+go 1.16
 
 require (
 	github.com/VictoriaMetrics/VictoriaMetrics v1.59.0
 	github.com/caarlos0/env/v6 v6.5.0
 	github.com/cespare/xxhash/v2 v2.1.1
+	github.com/hashicorp/go-multierror v1.1.0
 	github.com/hashicorp/vault/api v1.0.4
 	github.com/sirupsen/logrus v1.8.1
 	github.com/slack-go/slack v0.8.1
-	golang.org/x/time v0.0.0-20201208040808-7e3f01d25324 // indirect
+	golang.org/x/time v0.0.0-20201208040808-7e3f01d25324
+	k8s.io/api v0.20.2
 	k8s.io/apimachinery v0.20.2
 	k8s.io/client-go v0.20.2
+	k8s.io/metrics v0.20.2
 	k8s.io/utils v0.0.0-20210111153108-fddb29f9d009 // indirect
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -1,38 +1,97 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/caarlos0/env/v6"
 	"github.com/serge-r/podreporter/cmd"
 	log "github.com/sirupsen/logrus"
 	"github.com/slack-go/slack"
+	"net/mail"
 	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"sort"
 	"strings"
+	"syscall"
 	"time"
 )
 
 type options struct {
-	LogType             string        `env:"LOG_TYPE" envDefault:"text"`
-	LogLevel            string        `env:"LOG_LEVEL" envDefault:"info"`
-	Datacenters         []string      `env:"DATACENTERS" envSeparator:":"`
-	PrometheusServerUrl url.URL       `env:"PROM_SERVER_URL"`
-	PrometheusUsername  string        `env:"PROM_USERNAME"`
-	PrometheusPassword  string        `env:"PROM_PASSWORD"`
-	PrometheusTimeout   time.Duration `env:"PROM_TIMEOUT" envDefault:"5s"`
-	VaultURL            url.URL       `env:"VAULT_URL"`
-	VaultTimeout        time.Duration `env:"VAULT_TIMEOUT" envDefault:"5s"`
-	VaultRoleID         string        `env:"VAULT_ROLE_ID"`
-	VaultSecretID       string        `env:"VAULT_SECRET_ID"`
-	VaultSecretPath     string        `env:"VAULT_SECRET_PATH"`
-	VaultEnvironment    []string      `env:"VAULT_ENVIRONMENT" envDefault:"production:development" envSeparator:":"`
-	SlackBotToken       string        `env:"SLACK_BOT_TOKEN"`
-	SlackAppToken       string        `env:"SLACK_APP_TOKEN"`
-	SlackChannel        string        `env:"SLACK_CHANNEL"`
-	MaxConcurrency      int           `env:"MAX_CONCURRENCY" envDefault:"2"`
-	Namespaces          []string      `env:"NAMESPACES" envDefault:"kube-system" envSeparator:":"` // List of excluded namespaces
+	LogType                 string        `env:"LOG_TYPE" envDefault:"text"`
+	LogLevel                string        `env:"LOG_LEVEL" envDefault:"info"`
+	Datacenters             []string      `env:"DATACENTERS" envSeparator:":"`
+	PrometheusServerUrl     url.URL       `env:"PROM_SERVER_URL"`
+	MetricsBackend          string        `env:"METRICS_BACKEND" envDefault:"prometheus"` // prometheus, victoriametrics or metrics-server
+	VMTenant                string        `env:"VM_TENANT"`                               // VictoriaMetrics cluster tenant, accountID[:projectID]
+	PrometheusUsername      string        `env:"PROM_USERNAME"`
+	PrometheusPassword      string        `env:"PROM_PASSWORD"`
+	PrometheusTimeout       time.Duration `env:"PROM_TIMEOUT" envDefault:"5s"`
+	PrometheusQPS           float64       `env:"PROM_QPS" envDefault:"10"` // Queries per second, 0 - unlimited
+	PrometheusBurst         int           `env:"PROM_BURST" envDefault:"2"`
+	PrometheusBudget        float64       `env:"PROM_COST_BUDGET" envDefault:"0"`      // Evaluated points per second, 0 - unlimited
+	PrometheusStep          time.Duration `env:"PROM_COST_RESOLUTION" envDefault:"1m"` // Step for range selectors in cost estimation
+	PrometheusRetries       int           `env:"PROM_MAX_RETRIES" envDefault:"3"`      // Retries on 429 responses
+	CacheDir                string        `env:"CACHE_DIR"`                            // Directory for query responses cache, empty - disabled
+	CacheTTL                time.Duration `env:"CACHE_TTL" envDefault:"24h"`
+	CacheBucket             time.Duration `env:"CACHE_BUCKET" envDefault:"1h"` // Queries evaluated within one bucket share cache entry
+	EvalTime                string        `env:"EVAL_TIME"`                    // RFC3339 time, date or weekday name (as of its last 00:00 UTC), empty - now
+	VaultURL                url.URL       `env:"VAULT_URL"`
+	VaultTimeout            time.Duration `env:"VAULT_TIMEOUT" envDefault:"5s"`
+	VaultRoleID             string        `env:"VAULT_ROLE_ID"`
+	VaultSecretID           string        `env:"VAULT_SECRET_ID"`
+	VaultSecretPath         string        `env:"VAULT_SECRET_PATH"`
+	VaultEnvironment        []string      `env:"VAULT_ENVIRONMENT" envDefault:"production:development" envSeparator:":"`
+	SlackBotToken           string        `env:"SLACK_BOT_TOKEN"`
+	SlackAppToken           string        `env:"SLACK_APP_TOKEN"`
+	SlackChannel            string        `env:"SLACK_CHANNEL"`
+	SlackRows               int           `env:"SLACK_ROWS" envDefault:"5"`                        // Rows of every section in slack report
+	ReportSinks             []string      `env:"REPORT_SINKS" envDefault:"slack" envSeparator:":"` // Outputs of report command: slack, json, csv, html, markdown, smtp
+	JSONOutput              string        `env:"JSON_OUTPUT" envDefault:"-"`                       // File of json sink, "-" - stdout
+	CSVOutput               string        `env:"CSV_OUTPUT" envDefault:"-"`                        // File of csv sink, "-" - stdout
+	HTMLOutput              string        `env:"HTML_OUTPUT" envDefault:"report.html"`             // File of html sink, "-" - stdout
+	MarkdownOutput          string        `env:"MARKDOWN_OUTPUT" envDefault:"-"`                   // File of markdown sink, "-" - stdout, directory if teams are split
+	MarkdownSplitTeams      bool          `env:"MARKDOWN_SPLIT_TEAMS" envDefault:"false"`          // Write <team>.md for every team
+	MarkdownRows            int           `env:"MARKDOWN_ROWS" envDefault:"0"`                     // Rows of every section in markdown report, 0 - all rows
+	SMTPAddress             string        `env:"SMTP_ADDRESS"`                                     // host:port
+	SMTPUsername            string        `env:"SMTP_USERNAME"`                                    // Empty - authentication is disabled
+	SMTPPassword            string        `env:"SMTP_PASSWORD"`
+	SMTPStartTLS            bool          `env:"SMTP_STARTTLS" envDefault:"true"`
+	SMTPInsecureSkipVerify  bool          `env:"SMTP_INSECURE_SKIP_VERIFY" envDefault:"false"`
+	SMTPFrom                string        `env:"SMTP_FROM"`
+	SMTPTo                  []string      `env:"SMTP_TO" envSeparator:","` // Recipients of the whole report
+	SMTPTeamRecipients      string        `env:"SMTP_TEAM_RECIPIENTS"`     // Recipients of team reports: team=address,address;team=address
+	MaxConcurrency          int           `env:"MAX_CONCURRENCY" envDefault:"2"`
+	CPUThrottling           bool          `env:"CPU_THROTTLING" envDefault:"true"`                 // Query CFS throttling metrics
+	MemoryMetrics           []string      `env:"MEMORY_METRICS" envDefault:"rss" envSeparator:":"` // RAM usage: working_set alone, or sum of rss and cache
+	NetworkMetrics          bool          `env:"NETWORK_METRICS" envDefault:"false"`               // Query network receive/transmit rates
+	DiskMetrics             bool          `env:"DISK_METRICS" envDefault:"false"`                  // Query filesystem read/write rates
+	OOMPrediction           bool          `env:"OOM_PREDICTION" envDefault:"true"`                 // Query working set series for OOM prediction
+	OOMHorizon              time.Duration `env:"OOM_HORIZON" envDefault:"336h"`                    // Containers reaching memory limit within it are reported
+	OOMUsage                float64       `env:"OOM_USAGE" envDefault:"0.9"`                       // Containers using this share of memory limit are reported regardless of trend
+	IdleCPU                 float64       `env:"IDLE_CPU" envDefault:"5"`                          // Peak CPU of idle pods, millicores
+	IdleRAMGrowth           float64       `env:"IDLE_RAM_GROWTH" envDefault:"1"`                   // Working set trend of idle pods, Mi per day
+	IdleNetwork             float64       `env:"IDLE_NETWORK" envDefault:"0"`                      // Network rate of idle pods, bytes per second, 0 - not checked
+	ScoreOverThreshold      float64       `env:"SCORE_OVER_THRESHOLD" envDefault:"0.33"`           // Usage/requests below it is over-provisioned
+	ScoreUnderThreshold     float64       `env:"SCORE_UNDER_THRESHOLD" envDefault:"1"`             // Usage/requests above it is under-provisioned
+	UsagePercentile         float64       `env:"USAGE_PERCENTILE" envDefault:"0"`                  // Containers usage quantile for recommendations, 0 - peak
+	RecommendHeadroom       float64       `env:"RECOMMEND_HEADROOM" envDefault:"0.2"`              // Added to usage for recommended requests
+	RecommendCPULimitFactor float64       `env:"RECOMMEND_CPU_LIMIT_FACTOR" envDefault:"2"`        // Recommended limits to requests ratio, 0 - keep current
+	RecommendRAMLimitFactor float64       `env:"RECOMMEND_RAM_LIMIT_FACTOR" envDefault:"1.5"`
+	RecommendCPUStep        float64       `env:"RECOMMEND_CPU_STEP" envDefault:"50"`                           // Millicores
+	RecommendRAMStep        float64       `env:"RECOMMEND_RAM_STEP" envDefault:"64"`                           // Mi
+	PatchesDir              string        `env:"PATCHES_DIR" envDefault:"patches"`                             // Output directory of patches command
+	PatchFormats            []string      `env:"PATCH_FORMATS" envDefault:"strategic" envSeparator:":"`        // strategic, kustomize, kubectl
+	PolicyFile              string        `env:"POLICY_FILE"`                                                  // YAML file with policy rules, empty - disabled
+	PricingFile             string        `env:"PRICING_FILE"`                                                 // YAML file with resource prices, empty - no cost estimation
+	TeamLabel               string        `env:"TEAM_LABEL" envDefault:"team"`                                 // Pod or namespace label with team name
+	BestEffortDenied        []string      `env:"BESTEFFORT_DENIED_NAMESPACES" envDefault:"*" envSeparator:":"` // Namespace patterns, where BestEffort pods are reported
+	ProgressInterval        time.Duration `env:"PROGRESS_INTERVAL" envDefault:"30s"`                           // 0 - disable progress logging
+	RunTimeout              time.Duration `env:"RUN_TIMEOUT" envDefault:"0s"`                                  // Deadline for the whole run, 0 - no deadline
+	ReportTimeout           time.Duration `env:"REPORT_TIMEOUT" envDefault:"1m"`                               // Time for sending report, also after interruption
+	Namespaces              []string      `env:"NAMESPACES" envDefault:"kube-system" envSeparator:":"`         // List of excluded namespaces
 }
 
 func initLog(o *options) *log.Entry {
@@ -64,7 +123,23 @@ func initLog(o *options) *log.Entry {
 	return log.WithField("context", "deploy")
 }
 
-func parseOptions() (*options, error) {
+// Commands
+const (
+	commandReport  = "report"  // Send report to sinks, default
+	commandPatches = "patches" // Write patches for recommendations
+)
+
+// Report sinks
+const (
+	sinkSlack    = "slack"
+	sinkJSON     = "json"
+	sinkCSV      = "csv"
+	sinkHTML     = "html"
+	sinkMarkdown = "markdown"
+	sinkSMTP     = "smtp"
+)
+
+func parseOptions(command string) (*options, error) {
 	options := options{}
 	if err := env.Parse(&options); err != nil {
 		return nil, err
@@ -84,32 +159,271 @@ func parseOptions() (*options, error) {
 	if options.VaultSecretPath == "" {
 		return nil, errors.New("vault secret path is not provided")
 	}
-	if options.PrometheusServerUrl.String() == "" {
-		return nil, errors.New("prometheus server URL is not provided")
-	}
-	if options.SlackBotToken == "" {
-		return nil, errors.New("slack BOT token not provided")
+	switch options.MetricsBackend {
+	case "prometheus", "victoriametrics":
+		if options.PrometheusServerUrl.String() == "" {
+			return nil, errors.New("prometheus server URL is not provided")
+		}
+	case "metrics-server":
+		// Metrics server has no history
+		if options.NetworkMetrics || options.DiskMetrics {
+			return nil, errors.New("network and disk metrics are not provided by metrics server")
+		}
+		if options.UsagePercentile > 0 {
+			return nil, errors.New("usage percentile needs history, which metrics server does not have")
+		}
+		if options.EvalTime != "" {
+			return nil, errors.New("evaluation time needs history, which metrics server does not have")
+		}
+	default:
+		return nil, fmt.Errorf("unknown metrics backend %s", options.MetricsBackend)
 	}
-	if options.SlackAppToken == "" {
-		return nil, errors.New("slack APP token not provided")
+	switch command {
+	case commandReport:
+		if len(options.ReportSinks) == 0 {
+			return nil, errors.New("report sinks are not provided")
+		}
+		// Output of every sink is written whole, so only one of them may use stdout
+		outputs := map[string]string{
+			sinkJSON: options.JSONOutput,
+			sinkCSV:  options.CSVOutput,
+			sinkHTML: options.HTMLOutput,
+		}
+		if !options.MarkdownSplitTeams {
+			outputs[sinkMarkdown] = options.MarkdownOutput
+		}
+		var stdoutSinks []string
+		for _, sink := range options.ReportSinks {
+			if output, ok := outputs[sink]; ok && (output == "" || output == "-") {
+				stdoutSinks = append(stdoutSinks, sink)
+			}
+		}
+		if len(stdoutSinks) > 1 {
+			return nil, fmt.Errorf("report sinks %s write to stdout, provide output files of all but one", strings.Join(stdoutSinks, ", "))
+		}
+		for _, sink := range options.ReportSinks {
+			switch sink {
+			case sinkSlack:
+				if options.SlackBotToken == "" {
+					return nil, errors.New("slack BOT token not provided")
+				}
+				if options.SlackAppToken == "" {
+					return nil, errors.New("slack APP token not provided")
+				}
+				if options.SlackChannel == "" {
+					return nil, errors.New("slack channel not provided")
+				}
+				if options.SlackRows < 1 {
+					return nil, errors.New("slack rows must be positive")
+				}
+			case sinkMarkdown:
+				if options.MarkdownSplitTeams && (options.MarkdownOutput == "" || options.MarkdownOutput == "-") {
+					return nil, errors.New("markdown output directory must be provided to split teams")
+				}
+				if options.MarkdownRows < 0 {
+					return nil, errors.New("markdown rows must not be negative")
+				}
+			case sinkSMTP:
+				if options.SMTPAddress == "" {
+					return nil, errors.New("smtp address is not provided")
+				}
+				if options.SMTPFrom == "" {
+					return nil, errors.New("smtp sender is not provided")
+				}
+				recipients, err := cmd.ParseRecipients(options.SMTPTeamRecipients)
+				if err != nil {
+					return nil, err
+				}
+				if len(options.SMTPTo) == 0 && len(recipients) == 0 {
+					return nil, errors.New("smtp recipients are not provided")
+				}
+				for _, address := range options.SMTPTo {
+					if _, err := mail.ParseAddress(address); err != nil {
+						return nil, fmt.Errorf("invalid smtp recipient %q: %w", address, err)
+					}
+				}
+				if _, err := mail.ParseAddress(options.SMTPFrom); err != nil {
+					return nil, fmt.Errorf("invalid smtp sender %q: %w", options.SMTPFrom, err)
+				}
+			case sinkJSON, sinkCSV, sinkHTML:
+			default:
+				return nil, fmt.Errorf("unknown report sink %s", sink)
+			}
+		}
+	case commandPatches:
+		for _, format := range options.PatchFormats {
+			if format != cmd.PatchStrategic && format != cmd.PatchKustomize && format != cmd.PatchKubectl {
+				return nil, fmt.Errorf("unknown patch format %s", format)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown command %s, use %s or %s", command, commandReport, commandPatches)
 	}
-	if options.SlackChannel == "" {
-		return nil, errors.New("slack channel not provided")
+	if options.PrometheusQPS < 0 || options.PrometheusBudget < 0 {
+		return nil, errors.New("prometheus rate limits cannot be negative")
 	}
 	if options.MaxConcurrency < 2 {
 		return nil, errors.New("please set max concurency >= 2")
 	}
+	if options.ScoreOverThreshold <= 0 || options.ScoreOverThreshold >= options.ScoreUnderThreshold {
+		return nil, errors.New("score thresholds must be 0 < over < under")
+	}
+	if options.UsagePercentile < 0 || options.UsagePercentile > 1 {
+		return nil, errors.New("usage percentile must be between 0 and 1")
+	}
+	if options.RecommendHeadroom < 0 || options.RecommendCPULimitFactor < 0 || options.RecommendRAMLimitFactor < 0 {
+		return nil, errors.New("recommendation headroom and limit factors cannot be negative")
+	}
+	if err := cmd.ValidateMemoryMetrics(options.MemoryMetrics); err != nil {
+		return nil, err
+	}
+	if options.IdleCPU < 0 || options.IdleRAMGrowth < 0 || options.IdleNetwork < 0 {
+		return nil, errors.New("idle thresholds must not be negative")
+	}
+	if options.OOMHorizon <= 0 {
+		return nil, errors.New("OOM horizon must be positive")
+	}
+	if options.OOMUsage <= 0 || options.OOMUsage > 1 {
+		return nil, errors.New("OOM usage must be in (0, 1]")
+	}
+	for _, pattern := range options.BestEffortDenied {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid namespace pattern %s: %w", pattern, err)
+		}
+	}
+	if _, err := parseEvalTime(options.EvalTime, time.Now()); err != nil {
+		return nil, err
+	}
 	if len(options.Namespaces) > 1 {
 		sort.Strings(options.Namespaces)
 	}
 	return &options, nil
 }
 
+// parseEvalTime
+// Accepts RFC3339 time, date like 2006-01-02 or weekday name, which means its last midnight in UTC
+func parseEvalTime(value string, now time.Time) (time.Time, error) {
+	now = now.UTC()
+	if value == "" {
+		return now, nil
+	}
+	if evalTime, err := time.Parse(time.RFC3339, value); err == nil {
+		return evalTime, nil
+	}
+	if evalTime, err := time.Parse("2006-01-02", value); err == nil {
+		return evalTime, nil
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for days := 0; days < 7; days++ {
+		day := midnight.AddDate(0, 0, -days)
+		if strings.EqualFold(day.Weekday().String(), value) {
+			return day, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse evaluation time %q", value)
+}
+
+// createMetricsSource
+// Creates usage source for chosen backend, metrics server needs datacenters configs
+func createMetricsSource(options *options, datacenters []cmd.Datacenter, logger *log.Entry) (cmd.MetricsSource, error) {
+	if options.MetricsBackend == "metrics-server" {
+		logger.Warn("Metrics server provides only current usage, report will not use history")
+		logger.Warn("Working set trend is not available, idle workloads are detected without RAM criterion")
+		return cmd.CreateKubeMetrics(datacenters)
+	}
+
+	limiter := cmd.CreateLimiter(options.PrometheusQPS, options.PrometheusBurst, options.PrometheusBudget, options.PrometheusStep, logger)
+	var prom *cmd.Prometheus
+	var err error
+	if options.MetricsBackend == "victoriametrics" {
+		prom, err = cmd.VMCreate(options.PrometheusServerUrl.String(), options.VMTenant, options.PrometheusUsername, options.PrometheusPassword, options.PrometheusTimeout, limiter, options.PrometheusRetries, logger)
+	} else {
+		prom, err = cmd.PromCreate(options.PrometheusServerUrl.String(), options.PrometheusUsername, options.PrometheusPassword, options.PrometheusTimeout, limiter, options.PrometheusRetries, logger)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if options.CacheDir != "" {
+		cache, err := cmd.CreateCache(options.CacheDir, options.CacheTTL, options.CacheBucket, logger)
+		if err != nil {
+			return nil, err
+		}
+		prom.SetCache(cache)
+		logger.Infof("Query cache enabled in %s", options.CacheDir)
+	}
+	evalTime, _ := parseEvalTime(options.EvalTime, time.Now())
+	prom.SetEvalTime(evalTime)
+	logger.Infof("Queries will be evaluated at %s", evalTime.Format(time.RFC3339))
+
+	return cmd.CreatePromMetrics(prom, cmd.MetricsOptions{
+		Throttling:    options.CPUThrottling,
+		MemoryMetrics: options.MemoryMetrics,
+		Network:       options.NetworkMetrics,
+		Disk:          options.DiskMetrics,
+		Percentile:    options.UsagePercentile,
+		OOMPrediction: options.OOMPrediction,
+		Average:       options.PricingFile != "",
+	}), nil
+}
+
+// createSinks
+// Creates outputs of report command
+func createSinks(ctx context.Context, options *options, logger *log.Entry) ([]cmd.Sink, error) {
+	var sinks []cmd.Sink
+	for _, sink := range options.ReportSinks {
+		switch sink {
+		case sinkSlack:
+			logger.Info("Creating Slack connection")
+			// PromCreate slack
+			slackClient := slack.New(
+				options.SlackBotToken,
+				slack.OptionDebug(false),
+				//slack.OptionAppLevelToken(options.SlackAppToken),
+				//slack.OptionLog(logger)            // Not compatible wtth logrus - perhaps I can found solution
+
+			)
+			if _, err := slackClient.AuthTestContext(ctx); err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, cmd.CreateSlackSink(slackClient, options.SlackChannel, options.SlackRows))
+		case sinkJSON:
+			sinks = append(sinks, cmd.CreateJSONSink(options.JSONOutput))
+		case sinkCSV:
+			sinks = append(sinks, cmd.CreateCSVSink(options.CSVOutput))
+		case sinkHTML:
+			sinks = append(sinks, cmd.CreateHTMLSink(options.HTMLOutput))
+		case sinkMarkdown:
+			sinks = append(sinks, cmd.CreateMarkdownSink(options.MarkdownOutput, options.MarkdownSplitTeams, options.MarkdownRows))
+		case sinkSMTP:
+			recipients, err := cmd.ParseRecipients(options.SMTPTeamRecipients)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, cmd.CreateSMTPSink(cmd.SMTPOptions{
+				Address:            options.SMTPAddress,
+				Username:           options.SMTPUsername,
+				Password:           options.SMTPPassword,
+				StartTLS:           options.SMTPStartTLS,
+				InsecureSkipVerify: options.SMTPInsecureSkipVerify,
+				From:               options.SMTPFrom,
+				To:                 options.SMTPTo,
+				TeamRecipients:     recipients,
+			}))
+		}
+	}
+	return sinks, nil
+}
+
 func main() {
 	var datacenters []cmd.Datacenter
 
+	command := commandReport
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command = os.Args[1]
+	}
+
 	// PromCreate options
-	options, err := parseOptions()
+	options, err := parseOptions(command)
 	if err != nil {
 		panic(err)
 	}
@@ -119,6 +433,26 @@ func main() {
 
 	logger.Infof("Start app")
 
+	// Run context, cancelled by deadline or SIGTERM
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if options.RunTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), options.RunTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		select {
+		case sig := <-signals:
+			logger.Warnf("Got %s, stopping", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
 	// PromCreate vault client
 	vaultClient, err := cmd.VaultAuth(options.VaultURL,
 		options.VaultTimeout,
@@ -130,14 +464,6 @@ func main() {
 	}
 	logger.Info("Auth in vault successfully")
 
-	// PromCreate prometheus client
-	prom, err := cmd.PromCreate(options.PrometheusServerUrl.String(), options.PrometheusUsername, options.PrometheusPassword, options.PrometheusTimeout, logger)
-	if err != nil {
-		logger.Fatal(err)
-	}
-
-	logger.Info("Prometheus client ready")
-
 	// Fill datacenters structure
 	logger.Debugf("I found next datacenters %s", options.Datacenters)
 	for _, dc := range options.Datacenters {
@@ -155,41 +481,101 @@ func main() {
 			}
 		}
 		if tempDc.KubeConfig == nil {
-			logger.Warn("Cannot find config for %v+", tempDc.Name)
+			logger.Warnf("Cannot find config for %v", tempDc.Name)
 			continue
 		}
 		datacenters = append(datacenters, tempDc)
 	}
 
-	logger.Info("Creating Slack connection")
-	// PromCreate slack
-	slackClient := slack.New(
-		options.SlackBotToken,
-		slack.OptionDebug(false),
-		//slack.OptionAppLevelToken(options.SlackAppToken),
-		//slack.OptionLog(logger)            // Not compatible wtth logrus - perhaps I can found solution
-
-	)
-	_, err = slackClient.AuthTest()
+	source, err := createMetricsSource(options, datacenters, logger)
 	if err != nil {
 		logger.Fatal(err)
-		os.Exit(1)
+	}
+	logger.Infof("Metrics source %s ready", options.MetricsBackend)
+
+	var sinks []cmd.Sink
+	if command == commandReport {
+		sinks, err = createSinks(ctx, options, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
 	}
 
 	// Execute reporter
 	logger.Info("Creating reporter")
-	reporter := cmd.CreateReporter(datacenters, prom, slackClient, logger, options.MaxConcurrency)
+	reporter := cmd.CreateReporter(datacenters, source, logger, options.MaxConcurrency, options.ProgressInterval)
+	reporter.SetScoringOptions(cmd.ScoringOptions{
+		OverProvisioned:  options.ScoreOverThreshold,
+		UnderProvisioned: options.ScoreUnderThreshold,
+	})
+	reporter.SetRecommendOptions(cmd.RecommendOptions{
+		Headroom:       options.RecommendHeadroom,
+		CPULimitFactor: options.RecommendCPULimitFactor,
+		RAMLimitFactor: options.RecommendRAMLimitFactor,
+		CPUStep:        options.RecommendCPUStep,
+		RAMStep:        options.RecommendRAMStep,
+	})
+	if options.PolicyFile != "" {
+		policy, err := cmd.LoadPolicy(options.PolicyFile)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		reporter.SetPolicy(policy)
+		logger.Infof("Loaded %d policy rules from %s", len(policy.Rules), options.PolicyFile)
+	}
+	if options.PricingFile != "" {
+		pricing, err := cmd.LoadPricing(options.PricingFile)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		reporter.SetPricing(pricing)
+		logger.Infof("Loaded prices from %s", options.PricingFile)
+	}
+	reporter.SetTeamLabel(options.TeamLabel)
+	oomOptions := cmd.DefaultOOMOptions()
+	oomOptions.Horizon = options.OOMHorizon
+	oomOptions.Usage = options.OOMUsage
+	reporter.SetOOMOptions(oomOptions)
+	reporter.SetIdleOptions(cmd.IdleOptions{
+		CPU:       options.IdleCPU,
+		RAMGrowth: options.IdleRAMGrowth,
+		Network:   options.IdleNetwork,
+	})
+	reporter.SetBestEffortDenied(options.BestEffortDenied)
 	logger.Infof("Will exclude namespaces %s", options.Namespaces)
-	err = reporter.FillKubePods(options.Namespaces)
-	if err != nil {
+	err = reporter.FillKubePods(ctx, options.Namespaces)
+	if err != nil && ctx.Err() == nil {
 		logger.Errorf("Error filling pods: %v", err)
 		os.Exit(1)
 	}
-	err = reporter.FillPrometheusInfo()
+	// Interrupted listing keeps already listed datacenters, their pods stay without metrics
+	if err == nil {
+		err = reporter.FillPrometheusInfo(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Errorf("Error get prometheus info: %v", err)
+			os.Exit(1)
+		}
+	}
 	if err != nil {
-		logger.Errorf("Error get prometheus info: %v", err)
-		os.Exit(1)
+		logger.Warnf("Run was interrupted (%v), using partial data", ctx.Err())
 	}
-	reporter.GetReport(options.SlackChannel)
 
+	reporter.FillRecommendations()
+
+	if command == commandPatches {
+		patched, err := reporter.WritePatches(options.PatchesDir, options.PatchFormats)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		logger.Infof("Wrote patches for %d workloads to %s", patched, options.PatchesDir)
+		return
+	}
+
+	// Run context can be already done, so report has its own
+	reportCtx, reportCancel := context.WithTimeout(context.Background(), options.ReportTimeout)
+	defer reportCancel()
+	if err := reporter.GetReport(reportCtx, sinks); err != nil {
+		logger.Errorf("Error sending report: %v", err)
+		os.Exit(1)
+	}
 }